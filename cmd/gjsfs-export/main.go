@@ -0,0 +1,314 @@
+/*
+gjsfs-export compiles a directory ahead of time, for static deployment.
+
+It walks a directory the way merovius.de/go-misc/gjsfs would see it and writes
+a static tree to the output directory. Every .go entry point is compiled to
+.js, exactly as gjsfs would serve it, and written under a content-hashed
+name, e.g. app.go becomes app.1a2b3c4d5e.js, next to a source map of the same
+name with a .map suffix. All other files, except .js files (which gjsfs
+shadows with compiled .go files), are copied verbatim. A manifest mapping the
+logical names (as requested from gjsfs) to the hashed names is written as
+JSON, so the same paths work in development and production.
+
+The -entry, -tag, -marker and -hide flags correspond to the fields of
+gjsfs.Options. Files that gjsfs would not expose with them are not exported.
+If none of -entry, -tag and -marker is given, gjsfs compiles any .go file on
+request, so the entry points are all non-test files declaring package main
+instead of every .go file.
+
+Source maps refer to the .go files by their base name, so browsers can only
+show them if they are exported, i.e. if -hide is not given.
+
+Usage:
+
+	gjsfs-export [flags] -out <dir> [<root>]
+
+The root defaults to the current directory.
+
+The flags are:
+
+	-out dir
+		output directory. Required.
+
+	-manifest file
+		name of the manifest, relative to the output directory. Defaults to
+		"manifest.json".
+
+	-entry files
+		comma-separated list of entry points (as absolute, slash-separated
+		paths in root). Defaults to all main packages.
+
+	-tag tag
+		only compile files with a build constraint requiring tag.
+
+	-marker comment
+		only compile files with the line comment before the package clause.
+
+	-hide
+		do not export .go files.
+
+	-v
+		log what gjsfs does.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/neelance/sourcemap"
+
+	"merovius.de/go-misc/gjsfs"
+)
+
+var (
+	outDir   = flag.String("out", "", "Directory to write the static tree to")
+	manifest = flag.String("manifest", "manifest.json", "Name of the manifest in the output directory")
+	verbose  = flag.Bool("v", false, "Log what gjsfs does")
+	entry    = flag.String("entry", "", "Comma-separated list of entry points")
+	tag      = flag.String("tag", "", "Only compile files with a build constraint requiring tag")
+	marker   = flag.String("marker", "", "Only compile files with this comment before the package clause")
+	hide     = flag.Bool("hide", false, "Do not export .go files")
+)
+
+// hashLen is the number of hex digits of the content hash used in filenames.
+const hashLen = 10
+
+type exporter struct {
+	fs       http.FileSystem
+	root     string
+	out      string
+	manifest map[string]string
+	// restricted is set, if the gjsfs.Options select the entry points.
+	restricted bool
+
+	// build compiles the main package in the file name with contents src.
+	// It is replaced in tests.
+	build func(name string, src []byte) ([]byte, *sourcemap.Map, error)
+}
+
+func newExporter(root, out string, o gjsfs.Options) *exporter {
+	return &exporter{
+		fs:         gjsfs.NewWithOptions(http.Dir(root), o),
+		root:       root,
+		out:        out,
+		manifest:   make(map[string]string),
+		restricted: len(o.EntryPoints) > 0 || o.Tag != "" || o.Marker != "",
+		build:      gopherjsBuild,
+	}
+}
+
+func main() {
+	flag.Parse()
+	log.SetFlags(0)
+
+	if *outDir == "" || flag.NArg() > 1 {
+		log.Fatal("Usage: gjsfs-export [flags] -out=<dir> [<root>]")
+	}
+	root := "."
+	if flag.NArg() == 1 {
+		root = flag.Arg(0)
+	}
+	if !*verbose {
+		gjsfs.Log.SetOutput(ioutil.Discard)
+	}
+
+	o := gjsfs.Options{
+		Tag:         *tag,
+		Marker:      *marker,
+		HideSources: *hide,
+	}
+	if *entry != "" {
+		o.EntryPoints = strings.Split(*entry, ",")
+	}
+
+	if err := newExporter(root, *outDir, o).export(*manifest); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// export writes the static tree and the manifest, under the name manifest.
+func (e *exporter) export(manifest string) error {
+	if err := e.walk("/"); err != nil {
+		return err
+	}
+	buf, err := json.MarshalIndent(e.manifest, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(e.out, manifest), append(buf, '\n'), 0644)
+}
+
+// walk exports the directory dir recursively. It lists the source directory
+// and leaves it to gjsfs to decide which files are exposed.
+func (e *exporter) walk(dir string) error {
+	f, err := e.fs.Open(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	fis, err := ioutil.ReadDir(e.srcPath(dir))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(e.outPath(dir), 0755); err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		name := path.Join(dir, fi.Name())
+		switch {
+		case fi.IsDir() && e.isOut(name):
+			log.Printf("Skipping %s, it is the output directory", name)
+		case fi.IsDir():
+			err = e.walk(name)
+		case path.Ext(name) == ".js":
+			log.Printf("Skipping %s, it is shadowed by gjsfs", name)
+		case path.Ext(name) == ".go" && e.isEntryPoint(name):
+			err = e.compile(name)
+		default:
+			err = e.copy(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isEntryPoint returns whether the .go file name should be compiled. If the
+// entry points are selected by options, that is left to gjsfs. Otherwise,
+// only non-test files of main packages are compiled, as gjsfs would compile
+// any .go file on request, but other files can not run on their own.
+func (e *exporter) isEntryPoint(name string) bool {
+	if e.restricted {
+		return true
+	}
+	if strings.HasSuffix(name, "_test.go") {
+		return false
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), e.srcPath(name), nil, parser.PackageClauseOnly)
+	if err != nil {
+		return false
+	}
+	return f.Name.Name == "main"
+}
+
+// compile compiles the .go file name and writes it under a content-hashed
+// name, together with its source map. name itself is copied as well, unless
+// hidden, so the source map can refer to it.
+func (e *exporter) compile(name string) error {
+	logical := name[:len(name)-2] + "js"
+
+	// gjsfs only compiles when the file is read, so opening it just checks
+	// whether it is exposed.
+	f, err := e.fs.Open(logical)
+	if os.IsNotExist(err) {
+		return e.copy(name)
+	}
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	src, err := ioutil.ReadFile(e.srcPath(name))
+	if err != nil {
+		return err
+	}
+	code, m, err := e.build(name, src)
+	if err != nil {
+		return fmt.Errorf("compiling %s: %v", name, err)
+	}
+
+	sum := sha256.Sum256(code)
+	hashed := name[:len(name)-2] + hex.EncodeToString(sum[:])[:hashLen] + ".js"
+	e.manifest[strings.TrimPrefix(logical, "/")] = strings.TrimPrefix(hashed, "/")
+
+	m.File = path.Base(hashed)
+	buf := new(bytes.Buffer)
+	if err := m.WriteTo(buf); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(e.outPath(hashed+".map"), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	log.Printf("Compiled %s to %s", name, hashed)
+	code = append(code, "//# sourceMappingURL="+path.Base(hashed)+".map\n"...)
+	if err := ioutil.WriteFile(e.outPath(hashed), code, 0644); err != nil {
+		return err
+	}
+	return e.copy(name)
+}
+
+// gopherjsBuild compiles name with gjsfs.Compile and records its source map.
+func gopherjsBuild(name string, src []byte) ([]byte, *sourcemap.Map, error) {
+	buf := new(bytes.Buffer)
+	m := new(sourcemap.Map)
+	if err := gjsfs.Compile(name, bytes.NewReader(src), buf, m); err != nil {
+		return nil, nil, err
+	}
+	return buf.Bytes(), m, nil
+}
+
+// copy copies the file name from e.fs verbatim, unless it is not exposed.
+func (e *exporter) copy(name string) error {
+	f, err := e.fs.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	out, err := os.Create(e.outPath(name))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, f); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// isOut returns whether the directory name is the output directory.
+func (e *exporter) isOut(name string) bool {
+	a, err := filepath.Abs(e.srcPath(name))
+	if err != nil {
+		return false
+	}
+	b, err := filepath.Abs(e.out)
+	if err != nil {
+		return false
+	}
+	return a == b
+}
+
+func (e *exporter) srcPath(name string) string {
+	return filepath.Join(e.root, filepath.FromSlash(name))
+}
+
+func (e *exporter) outPath(name string) string {
+	return filepath.Join(e.out, filepath.FromSlash(name))
+}
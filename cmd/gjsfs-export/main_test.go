@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/neelance/sourcemap"
+
+	"merovius.de/go-misc/gjsfs"
+)
+
+func init() {
+	log.SetOutput(ioutil.Discard)
+	gjsfs.Log.SetOutput(ioutil.Discard)
+}
+
+// writeTree creates the files, given as slash-separated names mapped to
+// their contents, in a temporary directory and returns it.
+func writeTree(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// readTree returns all files below dir, as slash-separated names mapped to
+// their contents.
+func readTree(t *testing.T, dir string) map[string]string {
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		buf, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		files[filepath.ToSlash(rel)] = string(buf)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// export runs an exporter on root, with a fake compiler, and returns the
+// names it compiled.
+func export(t *testing.T, root, out string, o gjsfs.Options) []string {
+	var compiled []string
+	e := newExporter(root, out, o)
+	e.build = func(name string, src []byte) ([]byte, *sourcemap.Map, error) {
+		compiled = append(compiled, name)
+		return []byte("compiled " + string(src) + "\n"), new(sourcemap.Map), nil
+	}
+	if err := e.export("manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(compiled)
+	return compiled
+}
+
+func hashed(name, code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return strings.TrimSuffix(name, ".go") + "." + hex.EncodeToString(sum[:])[:hashLen] + ".js"
+}
+
+func TestExport(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"app.go":           "package main",
+		"app_test.go":      "package main",
+		"lib.go":           "package lib",
+		"old.js":           "shadowed",
+		"static/style.css": "body {}",
+		"sub/tool.go":      "package main // tool",
+	})
+	out := filepath.Join(root, "out")
+
+	compiled := export(t, root, out, gjsfs.Options{})
+	if want := []string{"/app.go", "/sub/tool.go"}; !reflect.DeepEqual(compiled, want) {
+		t.Errorf("compiled %q, want %q", compiled, want)
+	}
+
+	app := hashed("app.go", "compiled package main\n")
+	tool := hashed("sub/tool.go", "compiled package main // tool\n")
+	got := readTree(t, out)
+	manifest := got["manifest.json"]
+	delete(got, "manifest.json")
+	appMap := got[app+".map"]
+	delete(got, app+".map")
+	delete(got, tool+".map")
+
+	want := map[string]string{
+		app:                "compiled package main\n//# sourceMappingURL=" + filepath.Base(app) + ".map\n",
+		tool:               "compiled package main // tool\n//# sourceMappingURL=" + filepath.Base(tool) + ".map\n",
+		"app.go":           "package main",
+		"app_test.go":      "package main",
+		"lib.go":           "package lib",
+		"static/style.css": "body {}",
+		"sub/tool.go":      "package main // tool",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("exported %q, want %q", got, want)
+	}
+
+	var m map[string]string
+	if err := json.Unmarshal([]byte(manifest), &m); err != nil {
+		t.Fatalf("Invalid manifest: %v", err)
+	}
+	if want := map[string]string{"app.js": app, "sub/tool.js": tool}; !reflect.DeepEqual(m, want) {
+		t.Errorf("manifest = %q, want %q", m, want)
+	}
+
+	var sm struct {
+		File string `json:"file"`
+	}
+	if err := json.Unmarshal([]byte(appMap), &sm); err != nil {
+		t.Fatalf("Invalid source map: %v", err)
+	}
+	if sm.File != filepath.Base(app) {
+		t.Errorf("source map is for %q, want %q", sm.File, filepath.Base(app))
+	}
+}
+
+func TestExportOptions(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"app.go":      "package main",
+		"lib.go":      "package lib",
+		"sub/tool.go": "package main // tool",
+		"style.css":   "body {}",
+	})
+	out := t.TempDir()
+
+	compiled := export(t, root, out, gjsfs.Options{
+		EntryPoints: []string{"/app.go"},
+		HideSources: true,
+	})
+	if want := []string{"/app.go"}; !reflect.DeepEqual(compiled, want) {
+		t.Errorf("compiled %q, want %q", compiled, want)
+	}
+
+	app := hashed("app.go", "compiled package main\n")
+	var got []string
+	for name := range readTree(t, out) {
+		got = append(got, name)
+	}
+	sort.Strings(got)
+	if want := []string{app, app + ".map", "manifest.json", "style.css"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exported %q, want %q", got, want)
+	}
+}
+
+func TestExportNonMainEntryPoint(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"app.go": "package main",
+		"lib.go": "package lib",
+	})
+
+	// gjsfs compiles every selected entry point, not just main packages.
+	compiled := export(t, root, t.TempDir(), gjsfs.Options{
+		EntryPoints: []string{"/lib.go"},
+	})
+	if want := []string{"/lib.go"}; !reflect.DeepEqual(compiled, want) {
+		t.Errorf("compiled %q, want %q", compiled, want)
+	}
+}
@@ -0,0 +1,274 @@
+package ct
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and creates timers and tickers. Code using a Clock
+// instead of package time can be tested deterministically with a FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTicker is like time.NewTicker.
+	NewTicker(d time.Duration) ClockTicker
+	// NewTimer is like time.NewTimer.
+	NewTimer(d time.Duration) ClockTimer
+	// AfterFunc is like time.AfterFunc. The channel of the returned timer is
+	// not used.
+	AfterFunc(d time.Duration, f func()) ClockTimer
+	// After is like time.After.
+	After(d time.Duration) <-chan time.Time
+	// Sleep is like time.Sleep.
+	Sleep(d time.Duration)
+}
+
+// A ClockTicker is a ticker created by a Clock. It behaves like a
+// *time.Ticker, in particular its channel is not closed by Stop.
+type ClockTicker interface {
+	C() <-chan time.Time
+	Stop()
+	Reset(d time.Duration)
+}
+
+// A ClockTimer is a timer created by a Clock. It behaves like a *time.Timer,
+// in particular its channel is not closed by Stop.
+type ClockTimer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// RealClock is the Clock implemented by package time.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) ClockTicker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) NewTimer(d time.Duration) ClockTimer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time   { return t.t.C }
+func (t realTicker) Stop()                 { t.t.Stop() }
+func (t realTicker) Reset(d time.Duration) { t.t.Reset(d) }
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time        { return t.t.C }
+func (t realTimer) Stop() bool                 { return t.t.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+// FakeClock is a Clock for tests. Its time only moves when Advance is called,
+// which fires all timers and tickers that become due synchronously, in order.
+// Functions passed to AfterFunc are called synchronously as well, so they must
+// not block on Advance. Like with package time, a tick is dropped if the
+// previous one was not received yet.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+// NewFakeClock returns a FakeClock, set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond.L = &c.mu
+	return c
+}
+
+// Now returns the current time of c.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker firing every d, as c advances. d must be greater
+// than zero; if not, NewTicker will panic.
+func (c *FakeClock) NewTicker(d time.Duration) ClockTicker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.newTimer(d, d, nil)}
+}
+
+// NewTimer returns a timer firing once c advanced by d.
+func (c *FakeClock) NewTimer(d time.Duration) ClockTimer {
+	return c.newTimer(d, 0, nil)
+}
+
+// AfterFunc returns a timer calling f once c advanced by d. f is called by
+// Advance, or by AfterFunc or Reset, if d is not positive.
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return c.newTimer(d, 0, f)
+}
+
+// After waits for c to advance by d and then sends the current time on the
+// returned channel.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// Sleep blocks until c advanced by d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance moves the time of c forward by d, firing all timers and tickers
+// becoming due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	until := c.now.Add(d)
+	c.fire(until)
+	c.now = until
+}
+
+// BlockUntil blocks until at least n timers, tickers or calls to Sleep are
+// waiting on c. It is used to synchronize with goroutines using c, before
+// calling Advance.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	c      *FakeClock
+	ch     chan time.Time
+	when   time.Time
+	period time.Duration
+	f      func()
+	active bool
+}
+
+func (c *FakeClock) newTimer(d, period time.Duration, f func()) *fakeTimer {
+	t := &fakeTimer{c: c, ch: make(chan time.Time, 1), period: period, f: f}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.arm(t, d)
+	return t
+}
+
+// arm schedules t to fire after d and reports whether it was active. c.mu
+// must be held.
+func (c *FakeClock) arm(t *fakeTimer, d time.Duration) bool {
+	active := c.disarm(t)
+	t.when, t.active = c.now.Add(d), true
+	c.waiters = append(c.waiters, t)
+	c.cond.Broadcast()
+	c.fire(c.now)
+	return active
+}
+
+// disarm stops t and reports whether it was active. c.mu must be held.
+func (c *FakeClock) disarm(t *fakeTimer) bool {
+	if !t.active {
+		return false
+	}
+	t.active = false
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// fire fires all timers due at or before until, in order. c.mu must be held.
+// It is released while calling functions passed to AfterFunc.
+func (c *FakeClock) fire(until time.Time) {
+	for {
+		var t *fakeTimer
+		for _, w := range c.waiters {
+			if t == nil || w.when.Before(t.when) {
+				t = w
+			}
+		}
+		if t == nil || t.when.After(until) {
+			return
+		}
+		if t.when.After(c.now) {
+			c.now = t.when
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.disarm(t)
+		}
+		if t.f != nil {
+			c.mu.Unlock()
+			t.f()
+			c.mu.Lock()
+			continue
+		}
+		select {
+		case t.ch <- c.now:
+		default:
+		}
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	return t.c.disarm(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	return t.c.arm(t, d)
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+func (t fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	t.period = d
+	t.c.arm(t.fakeTimer, d)
+}
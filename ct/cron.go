@@ -0,0 +1,353 @@
+package ct
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Cron is a parsed cron expression. It has either five fields
+//
+//	minute hour day-of-month month day-of-week
+//
+// or six, with a leading second field. Every field is a comma-separated list
+// of values, ranges ("1-5") or "*", optionally followed by a step ("*/15",
+// "0-30/10", "5/20"). Months and days of the week can be given by their
+// three-letter English names ("JAN", "sun"). Sunday is 0 or 7. "?" is
+// accepted as "*" for the day fields. As with the traditional cron, if both
+// day fields are restricted, a day matches if either of them does.
+//
+// The macros @yearly (or @annually), @monthly, @weekly, @daily (or @midnight)
+// and @hourly are supported as well.
+//
+// Times are interpreted in a location. Wall clock times skipped by a daylight
+// saving time transition are scheduled at the transition. Wall clock times
+// occurring twice are scheduled at their first occurrence only, unless the
+// hour field is "*", so e.g. "*/15 * * * *" keeps firing every 15 minutes.
+type Cron struct {
+	expr   string
+	loc    *time.Location
+	second uint64
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	// anyHour, anyDom and anyDow are set if the respective field is "*".
+	anyHour bool
+	anyDom  bool
+	anyDow  bool
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+var (
+	secondField = cronField{"second", 0, 59, nil}
+	minuteField = cronField{"minute", 0, 59, nil}
+	hourField   = cronField{"hour", 0, 23, nil}
+	domField    = cronField{"day of month", 1, 31, nil}
+	monthField  = cronField{"month", 1, 12, []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField    = cronField{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+// cronYears is how many years Next looks ahead, before giving up.
+const cronYears = 10
+
+// ParseCron parses a cron expression, to be interpreted in loc. If loc is
+// nil, time.Local is used.
+func ParseCron(expr string, loc *time.Location) (*Cron, error) {
+	if loc == nil {
+		loc = time.Local
+	}
+	c := &Cron{expr: expr, loc: loc}
+
+	s := strings.TrimSpace(expr)
+	if m, ok := cronMacros[strings.ToLower(s)]; ok {
+		s = m
+	} else if strings.HasPrefix(s, "@") {
+		return nil, fmt.Errorf("ct: unknown cron macro %q", s)
+	}
+	fs := strings.Fields(s)
+	switch len(fs) {
+	case 5:
+		fs = append([]string{"0"}, fs...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("ct: cron expression %q has %d fields, want 5 or 6", expr, len(fs))
+	}
+
+	var err error
+	parse := func(f cronField, s string, any *bool) uint64 {
+		if err != nil {
+			return 0
+		}
+		if any != nil {
+			*any = s == "*" || s == "?"
+		}
+		var bits uint64
+		bits, err = f.parse(s)
+		return bits
+	}
+	c.second = parse(secondField, fs[0], nil)
+	c.minute = parse(minuteField, fs[1], nil)
+	c.hour = parse(hourField, fs[2], &c.anyHour)
+	c.dom = parse(domField, fs[3], &c.anyDom)
+	c.month = parse(monthField, fs[4], nil)
+	c.dow = parse(dowField, fs[5], &c.anyDow)
+	if err != nil {
+		return nil, err
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+// parse parses a field into a bitset of the values it matches.
+func (f cronField) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, r := range strings.Split(s, ",") {
+		lo, hi, step := f.min, f.max, 1
+		if i := strings.IndexByte(r, '/'); i >= 0 {
+			n, err := strconv.Atoi(r[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("ct: invalid step in %s field %q", f.name, s)
+			}
+			step, r = n, r[:i]
+		}
+		switch {
+		case r == "*", r == "?" && (f.name == domField.name || f.name == dowField.name):
+		case strings.IndexByte(r, '-') >= 0:
+			i := strings.IndexByte(r, '-')
+			var err error
+			if lo, err = f.value(r[:i]); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(r[i+1:]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("ct: invalid range in %s field %q", f.name, s)
+			}
+		default:
+			var err error
+			if lo, err = f.value(r); err != nil {
+				return 0, err
+			}
+			if step == 1 {
+				hi = lo
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single value of the field.
+func (f cronField) value(s string) (int, error) {
+	for i, n := range f.names {
+		if n != "" && strings.EqualFold(s, n) {
+			return i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("ct: invalid %s %q", f.name, s)
+	}
+	return v, nil
+}
+
+// String returns the expression c was parsed from.
+func (c *Cron) String() string {
+	return c.expr
+}
+
+// Location returns the location c is interpreted in.
+func (c *Cron) Location() *time.Location {
+	return c.loc
+}
+
+// Next returns the first time after t matching c, in the location of c. If
+// there is no such time within the next years (e.g. for "0 0 30 2 *"), Next
+// returns the zero Time.
+func (c *Cron) Next(t time.Time) time.Time {
+	w := wallTime(t, offset(t, c.loc))
+	// Wall clock times repeated by a transition shortly after t map to
+	// instants after t, even if they are before w.
+	if end := t.Add(48 * time.Hour); offset(end, c.loc) < offset(t, c.loc) {
+		if r := wallTime(transition(t, end, c.loc), offset(end, c.loc)); r.Before(w) {
+			w = r
+		}
+	}
+	limit := t.In(c.loc).Year() + cronYears
+
+	var (
+		best   time.Time
+		maxOff int
+	)
+	for w = c.nextWall(w.Truncate(time.Second), limit); !w.IsZero(); w = c.nextWall(w.Add(time.Second), limit) {
+		// Later wall clock times can only map to earlier instants, if the
+		// offset was larger in between.
+		if !best.IsZero() && w.Add(-time.Duration(maxOff)*time.Second).After(best) {
+			break
+		}
+		for _, u := range c.instants(w) {
+			if u.After(t) && (best.IsZero() || u.Before(best)) {
+				best = u
+				from := best.Add(-24 * time.Hour)
+				if from.Before(t) {
+					from = t
+				}
+				maxOff = maxInt(offset(from, c.loc), offset(best, c.loc))
+			}
+		}
+	}
+	return best
+}
+
+// nextWall returns the first wall clock time at or after w matching c, or the
+// zero Time if there is none before the year limit. Wall clock times are
+// represented in UTC.
+func (c *Cron) nextWall(w time.Time, limit int) time.Time {
+wrap:
+	for w.Year() <= limit {
+		for !has(c.month, int(w.Month())) {
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			if w.Month() == time.January {
+				continue wrap
+			}
+		}
+		for !c.dayMatches(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+			if w.Day() == 1 {
+				continue wrap
+			}
+		}
+		for !has(c.hour, w.Hour()) {
+			w = w.Truncate(time.Hour).Add(time.Hour)
+			if w.Hour() == 0 {
+				continue wrap
+			}
+		}
+		for !has(c.minute, w.Minute()) {
+			w = w.Truncate(time.Minute).Add(time.Minute)
+			if w.Minute() == 0 {
+				continue wrap
+			}
+		}
+		for !has(c.second, w.Second()) {
+			w = w.Add(time.Second)
+			if w.Second() == 0 {
+				continue wrap
+			}
+		}
+		return w
+	}
+	return time.Time{}
+}
+
+func (c *Cron) dayMatches(w time.Time) bool {
+	dom, dow := has(c.dom, w.Day()), has(c.dow, int(w.Weekday()))
+	if c.anyDom || c.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// instants returns the instants at which the wall clock in c.loc shows w, in
+// order. If w is skipped by a transition, it returns the transition instead.
+func (c *Cron) instants(w time.Time) []time.Time {
+	u0 := time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, c.loc)
+
+	var us, cands []time.Time
+	for _, d := range []time.Duration{-36 * time.Hour, 0, 36 * time.Hour} {
+		u := w.Add(-time.Duration(offset(u0.Add(d), c.loc)) * time.Second).In(c.loc)
+		if containsTime(cands, u) {
+			continue
+		}
+		cands = append(cands, u)
+		if wallTime(u, offset(u, c.loc)).Equal(w) {
+			us = append(us, u)
+		}
+	}
+	sort.Slice(us, func(i, j int) bool { return us[i].Before(us[j]) })
+	sort.Slice(cands, func(i, j int) bool { return cands[i].Before(cands[j]) })
+
+	if len(us) == 0 {
+		return []time.Time{transition(cands[0], cands[len(cands)-1], c.loc)}
+	}
+	if !c.anyHour {
+		us = us[:1]
+	}
+	return us
+}
+
+// transition returns the first instant in (lo, hi] with the offset of hi in
+// loc, which must differ from that of lo. It assumes there is only one
+// transition in between.
+func transition(lo, hi time.Time, loc *time.Location) time.Time {
+	// Transitions happen at whole seconds.
+	want := offset(hi, loc)
+	l, h := lo.Unix(), hi.Unix()
+	if hi.Nanosecond() > 0 {
+		h++
+	}
+	for h-l > 1 {
+		m := l + (h-l)/2
+		if offset(time.Unix(m, 0), loc) == want {
+			h = m
+		} else {
+			l = m
+		}
+	}
+	return time.Unix(h, 0).In(loc)
+}
+
+// offset returns the offset of loc at t, in seconds east of UTC.
+func offset(t time.Time, loc *time.Location) int {
+	_, off := t.In(loc).Zone()
+	return off
+}
+
+// wallTime returns the wall clock time of t at the offset off, in UTC.
+func wallTime(t time.Time, off int) time.Time {
+	return t.UTC().Add(time.Duration(off) * time.Second)
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func containsTime(ts []time.Time, t time.Time) bool {
+	for _, u := range ts {
+		if u.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,131 @@
+package ct
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"? * * * *",
+		"* * * foo *",
+		"@fortnightly",
+	} {
+		if _, err := ParseCron(expr, time.UTC); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	date := func(loc *time.Location, y int, m time.Month, d, hh, mm, ss int) time.Time {
+		return time.Date(y, m, d, hh, mm, ss, 0, loc)
+	}
+	utc := func(y int, m time.Month, d, hh, mm, ss int) time.Time {
+		return date(time.UTC, y, m, d, hh, mm, ss)
+	}
+
+	tcs := []struct {
+		expr string
+		loc  *time.Location
+		t    time.Time
+		want []time.Time
+	}{
+		{"* * * * *", time.UTC, utc(2024, 1, 1, 12, 0, 30), []time.Time{
+			utc(2024, 1, 1, 12, 1, 0),
+			utc(2024, 1, 1, 12, 2, 0),
+		}},
+		{"*/10 * * * * *", time.UTC, utc(2024, 1, 1, 12, 0, 5).Add(time.Millisecond), []time.Time{
+			utc(2024, 1, 1, 12, 0, 10),
+			utc(2024, 1, 1, 12, 0, 20),
+		}},
+		{"@hourly", time.UTC, utc(2024, 12, 31, 23, 59, 59), []time.Time{
+			utc(2025, 1, 1, 0, 0, 0),
+			utc(2025, 1, 1, 1, 0, 0),
+		}},
+		{"15 10 * * mon-fri", time.UTC, utc(2024, 9, 7, 0, 0, 0), []time.Time{
+			utc(2024, 9, 9, 10, 15, 0),
+			utc(2024, 9, 10, 10, 15, 0),
+		}},
+		{"0 0 * * 7", time.UTC, utc(2024, 9, 2, 0, 0, 0), []time.Time{
+			utc(2024, 9, 8, 0, 0, 0),
+		}},
+		// Both day fields restricted: either matches.
+		{"0 0 13 * fri", time.UTC, utc(2024, 9, 1, 0, 0, 0), []time.Time{
+			utc(2024, 9, 6, 0, 0, 0),
+			utc(2024, 9, 13, 0, 0, 0),
+			utc(2024, 9, 20, 0, 0, 0),
+		}},
+		{"0 12 1-7/3,20 JAN,Jul ?", time.UTC, utc(2024, 1, 2, 0, 0, 0), []time.Time{
+			utc(2024, 1, 4, 12, 0, 0),
+			utc(2024, 1, 7, 12, 0, 0),
+			utc(2024, 1, 20, 12, 0, 0),
+			utc(2024, 7, 1, 12, 0, 0),
+		}},
+		{"0 0 29 2 *", time.UTC, utc(2025, 1, 1, 0, 0, 0), []time.Time{
+			utc(2028, 2, 29, 0, 0, 0),
+		}},
+		{"0 0 30 2 *", time.UTC, utc(2025, 1, 1, 0, 0, 0), []time.Time{
+			{},
+		}},
+		{"0 3 * * *", berlin, date(berlin, 2024, 3, 30, 12, 0, 0), []time.Time{
+			date(berlin, 2024, 3, 31, 3, 0, 0),
+			date(berlin, 2024, 4, 1, 3, 0, 0),
+		}},
+		// Skipped by the transition to summer time.
+		{"30 2 * * *", berlin, date(berlin, 2024, 3, 30, 12, 0, 0), []time.Time{
+			utc(2024, 3, 31, 1, 0, 0),
+			date(berlin, 2024, 4, 1, 2, 30, 0),
+		}},
+		// Repeated by the transition to winter time.
+		{"30 2 * * *", berlin, date(berlin, 2024, 10, 27, 0, 0, 0), []time.Time{
+			utc(2024, 10, 27, 0, 30, 0),
+			utc(2024, 10, 28, 1, 30, 0),
+		}},
+		{"*/30 * * * *", berlin, utc(2024, 10, 26, 23, 45, 0), []time.Time{
+			utc(2024, 10, 27, 0, 0, 0),
+			utc(2024, 10, 27, 0, 30, 0),
+			utc(2024, 10, 27, 1, 0, 0),
+			utc(2024, 10, 27, 1, 30, 0),
+			utc(2024, 10, 27, 2, 0, 0),
+		}},
+		{"*/30 * * * *", berlin, utc(2024, 3, 31, 0, 15, 0), []time.Time{
+			utc(2024, 3, 31, 0, 30, 0),
+			utc(2024, 3, 31, 1, 0, 0),
+			utc(2024, 3, 31, 1, 30, 0),
+		}},
+	}
+	for _, tc := range tcs {
+		c, err := ParseCron(tc.expr, tc.loc)
+		if err != nil {
+			t.Errorf("ParseCron(%q) = %v", tc.expr, err)
+			continue
+		}
+		ti := tc.t
+		for _, want := range tc.want {
+			got := c.Next(ti)
+			if !got.Equal(want) {
+				t.Errorf("%q.Next(%v) = %v, want %v", tc.expr, ti, got, want)
+				break
+			}
+			if !got.IsZero() && got.Location() != tc.loc {
+				t.Errorf("%q.Next(%v) is in %v, want %v", tc.expr, ti, got.Location(), tc.loc)
+			}
+			ti = got
+		}
+	}
+}
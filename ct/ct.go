@@ -1,13 +1,47 @@
-// Package ct provides a wrapper around time.Ticker that closes the channel on Stop.
+// Package ct provides wrappers around time.Ticker and time.Timer that close
+// their channel on Stop.
 package ct
 
-import "time"
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
 
 // A Ticker holds a channel that delivers `ticks' of a clock at intervals.
 type Ticker struct {
-	c    chan time.Time
-	done chan bool
-	t    *time.Ticker
+	c      chan time.Time
+	stop   *stopper
+	ctl    chan tickerCmd
+	ack    chan struct{}
+	clock  Clock
+	jitter time.Duration
+}
+
+// TickerOptions contain optional configuration for a Ticker.
+type TickerOptions struct {
+	// Jitter, if positive, delays every tick by a random duration in
+	// [0,Jitter), e.g. to avoid many replicas ticking in lock-step. Ticks are
+	// delayed relative to their place in the period, so the delays don't add
+	// up.
+	Jitter time.Duration
+
+	// Clock, if not nil, is used instead of RealClock.
+	Clock Clock
+}
+
+type tickerOp int
+
+const (
+	tickerReset tickerOp = iota
+	tickerPause
+	tickerResume
+)
+
+type tickerCmd struct {
+	op tickerOp
+	d  time.Duration
 }
 
 // NewTicker returns a new Ticker containing a channel that will send the time
@@ -16,23 +50,107 @@ type Ticker struct {
 // than zero; if not, NewTicker will panic. Stop the ticker to release
 // associated resources.
 func NewTicker(d time.Duration) *Ticker {
+	return NewTickerWithOptions(d, TickerOptions{})
+}
+
+// NewTickerWithOptions is like NewTicker, but configures the Ticker with o.
+func NewTickerWithOptions(d time.Duration, o TickerOptions) *Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
 	t := &Ticker{
-		c:    make(chan time.Time),
-		done: make(chan bool),
-		t:    time.NewTicker(d),
-	}
-	go func() {
-		for {
-			select {
-			case ti := <-t.t.C:
-				t.c <- ti
-			case <-t.done:
-				close(t.c)
-				return
+		c:      make(chan time.Time),
+		stop:   newStopper(),
+		ctl:    make(chan tickerCmd),
+		ack:    make(chan struct{}),
+		clock:  o.Clock,
+		jitter: o.Jitter,
+	}
+	if t.clock == nil {
+		t.clock = RealClock
+	}
+	go t.run(d)
+	return t
+}
+
+// run delivers ticks with period d, until the ticker is stopped. The n-th
+// tick is scheduled at base+n·d, plus jitter.
+func (t *Ticker) run(d time.Duration) {
+	base, n := t.clock.Now(), int64(1)
+	timer := t.clock.NewTimer(t.until(base, n, d))
+	var (
+		paused  bool
+		pending time.Time
+		out     chan time.Time
+	)
+	for {
+		var tick <-chan time.Time
+		if !paused {
+			tick = timer.C()
+		}
+		select {
+		case ti := <-tick:
+			// A tick that was not received yet is dropped.
+			pending, out = ti, t.c
+			// Skip ticks we are too late for.
+			if m := int64(t.clock.Now().Sub(base) / d); m > n {
+				n = m
+			}
+			n++
+			timer.Reset(t.until(base, n, d))
+		case out <- pending:
+			out = nil
+		case cmd := <-t.ctl:
+			stopTimer(timer)
+			switch cmd.op {
+			case tickerReset:
+				d = cmd.d
+			case tickerPause:
+				paused, out = true, nil
+			case tickerResume:
+				paused = false
 			}
+			if !paused {
+				base, n = t.clock.Now(), 1
+				timer.Reset(t.until(base, n, d))
+			}
+			t.ack <- struct{}{}
+		case <-t.stop.done:
+			timer.Stop()
+			close(t.c)
+			close(t.stop.exited)
+			return
 		}
-	}()
-	return t
+	}
+}
+
+// until returns the time until the n-th tick after base with period d.
+func (t *Ticker) until(base time.Time, n int64, d time.Duration) time.Duration {
+	at := base.Add(time.Duration(n) * d)
+	if t.jitter > 0 {
+		at = at.Add(time.Duration(rand.Int63n(int64(t.jitter))))
+	}
+	return at.Sub(t.clock.Now())
+}
+
+// stopTimer stops timer and drains its channel.
+func stopTimer(timer ClockTimer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C():
+		default:
+		}
+	}
+}
+
+// send passes cmd to the ticker goroutine and waits for it to be applied. It
+// does nothing after Stop.
+func (t *Ticker) send(cmd tickerCmd) {
+	select {
+	case t.ctl <- cmd:
+		<-t.ack
+	case <-t.stop.done:
+	}
 }
 
 // C returns the channel where ticks are delivered.
@@ -40,9 +158,72 @@ func (t *Ticker) C() <-chan time.Time {
 	return t.c
 }
 
+// Reset stops the ticker and resets its period to d. The next tick arrives
+// after d has elapsed. If the ticker is paused, it stays paused. The duration
+// d must be greater than zero; if not, Reset will panic.
+func (t *Ticker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+	t.send(tickerCmd{op: tickerReset, d: d})
+}
+
+// Pause suspends delivery of ticks, until Resume is called. A tick that was
+// not received yet is dropped.
+func (t *Ticker) Pause() {
+	t.send(tickerCmd{op: tickerPause})
+}
+
+// Resume resumes delivery of ticks after Pause. The next tick arrives after a
+// full period.
+func (t *Ticker) Resume() {
+	t.send(tickerCmd{op: tickerResume})
+}
+
 // Stop turns off a ticker. After Stop, no more ticks will be sent. Stop closes
-// the channel, so you can range over it.
+// the channel, so you can range over it. Stop may be called multiple times and
+// from any goroutine.
 func (t *Ticker) Stop() {
-	t.t.Stop()
-	close(t.done)
+	t.stop.stop()
+}
+
+// Done returns a channel that is closed when Stop is called.
+func (t *Ticker) Done() <-chan struct{} {
+	return t.stop.done
+}
+
+// StopContext stops the ticker, like Stop, and waits for its channel to be
+// closed. If ctx is done first, it returns ctx.Err().
+func (t *Ticker) StopContext(ctx context.Context) error {
+	t.stop.stop()
+	return t.stop.wait(ctx)
+}
+
+// stopper signals a goroutine to exit and waits for it to do so.
+type stopper struct {
+	once sync.Once
+	// done is closed to signal the goroutine to exit.
+	done chan struct{}
+	// exited is closed by the goroutine before it exits.
+	exited chan struct{}
+}
+
+func newStopper() *stopper {
+	return &stopper{
+		done:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+}
+
+func (s *stopper) stop() {
+	s.once.Do(func() { close(s.done) })
+}
+
+func (s *stopper) wait(ctx context.Context) error {
+	select {
+	case <-s.exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,225 @@
+package ct
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2009, 11, 10, 23, 0, 0, 0, time.UTC)
+
+func TestFakeClock(t *testing.T) {
+	c := NewFakeClock(epoch)
+	tk := c.NewTicker(time.Second)
+	tm := c.NewTimer(1500 * time.Millisecond)
+
+	c.Advance(time.Second)
+	if got, want := <-tk.C(), epoch.Add(time.Second); !got.Equal(want) {
+		t.Errorf("tick = %v, want %v", got, want)
+	}
+	c.Advance(time.Second)
+	if got, want := <-tm.C(), epoch.Add(1500*time.Millisecond); !got.Equal(want) {
+		t.Errorf("timer = %v, want %v", got, want)
+	}
+	if got, want := <-tk.C(), epoch.Add(2*time.Second); !got.Equal(want) {
+		t.Errorf("tick = %v, want %v", got, want)
+	}
+	if tm.Stop() {
+		t.Error("Stop() = true after timer fired")
+	}
+	if tm.Reset(time.Second) {
+		t.Error("Reset() = true after timer fired")
+	}
+	if !tm.Stop() {
+		t.Error("Stop() = false on active timer")
+	}
+	tk.Stop()
+	c.Advance(time.Hour)
+	select {
+	case <-tk.C():
+		t.Error("stopped ticker ticked")
+	case <-tm.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	if got, want := c.Now(), epoch.Add(time.Hour+2*time.Second); !got.Equal(want) {
+		t.Errorf("Now() = %v, want %v", got, want)
+	}
+}
+
+func TestFakeClockSleep(t *testing.T) {
+	c := NewFakeClock(epoch)
+	done := make(chan bool)
+	go func() {
+		c.Sleep(time.Minute)
+		close(done)
+	}()
+	c.BlockUntil(1)
+	c.Advance(59 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("Sleep returned early")
+	default:
+	}
+	c.Advance(time.Second)
+	<-done
+}
+
+func TestFakeClockAfterFunc(t *testing.T) {
+	c := NewFakeClock(epoch)
+	var got []time.Time
+	var tm ClockTimer
+	tm = c.AfterFunc(time.Second, func() {
+		got = append(got, c.Now())
+		if len(got) == 1 {
+			// Re-arming from f must not deadlock.
+			tm.Reset(time.Second)
+		}
+	})
+	stopped := c.AfterFunc(time.Second, func() {
+		t.Error("stopped AfterFunc called")
+	})
+	if !stopped.Stop() {
+		t.Error("Stop() = false on active timer")
+	}
+	c.Advance(3 * time.Second)
+	want := []time.Time{epoch.Add(time.Second), epoch.Add(2 * time.Second)}
+	if len(got) != len(want) || !got[0].Equal(want[0]) || !got[1].Equal(want[1]) {
+		t.Errorf("AfterFunc called at %v, want %v", got, want)
+	}
+}
+
+func TestTicker(t *testing.T) {
+	c := NewFakeClock(epoch)
+	tk := NewTickerWithOptions(time.Second, TickerOptions{Clock: c})
+
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	if got, want := <-tk.C(), epoch.Add(time.Second); !got.Equal(want) {
+		t.Errorf("tick = %v, want %v", got, want)
+	}
+
+	tk.Pause()
+	c.Advance(time.Minute)
+	select {
+	case <-tk.C():
+		t.Error("paused ticker ticked")
+	default:
+	}
+	tk.Resume()
+	tk.Reset(time.Minute)
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	if got, want := <-tk.C(), epoch.Add(2*time.Minute+time.Second); !got.Equal(want) {
+		t.Errorf("tick = %v, want %v", got, want)
+	}
+
+	tk.Stop()
+	for range tk.C() {
+		t.Error("tick after Stop")
+	}
+}
+
+func TestTickerJitter(t *testing.T) {
+	c := NewFakeClock(epoch)
+	tk := NewTickerWithOptions(time.Second, TickerOptions{Clock: c, Jitter: 500 * time.Millisecond})
+	defer tk.Stop()
+
+	// The n-th tick is in [n s, n s + 500ms), so every step contains exactly
+	// one tick, unless the delays add up.
+	c.BlockUntil(1)
+	c.Advance(500 * time.Millisecond)
+	for i := 1; i <= 100; i++ {
+		c.BlockUntil(1)
+		c.Advance(time.Second)
+		select {
+		case ti := <-tk.C():
+			if d := ti.Sub(epoch.Add(time.Duration(i) * time.Second)); d < 0 || d >= 500*time.Millisecond {
+				t.Fatalf("tick %d is %v after its place in the period, want in [0,500ms)", i, d)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("tick %d missing", i)
+		}
+	}
+}
+
+func TestTickerStopConcurrent(t *testing.T) {
+	tk := NewTicker(time.Microsecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				switch (i + j) % 4 {
+				case 0:
+					tk.Reset(time.Duration(j+1) * time.Microsecond)
+				case 1:
+					tk.Pause()
+				case 2:
+					tk.Resume()
+				case 3:
+					<-tk.Done()
+				}
+			}
+		}(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tk.Stop()
+		}()
+	}
+	wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tk.StopContext(ctx); err != nil {
+		t.Fatalf("StopContext() = %v", err)
+	}
+	for range tk.C() {
+	}
+}
+
+func TestTickerSlowReceiver(t *testing.T) {
+	c := NewFakeClock(epoch)
+	tk := NewTickerWithOptions(time.Second, TickerOptions{Clock: c})
+	for i := 0; i < 3; i++ {
+		c.BlockUntil(1)
+		c.Advance(time.Second)
+	}
+	c.BlockUntil(1)
+	// Nobody received the pending tick, Stop must not block the ticker.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tk.StopContext(ctx); err != nil {
+		t.Fatalf("StopContext() = %v", err)
+	}
+	if _, ok := <-tk.C(); ok {
+		t.Error("tick after Stop")
+	}
+}
+
+func TestTickerLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var tks []*Ticker
+	for i := 0; i < 100; i++ {
+		tks = append(tks, NewTicker(time.Millisecond))
+	}
+	time.Sleep(5 * time.Millisecond)
+	for _, tk := range tks {
+		tk.Stop()
+		if err := tk.StopContext(ctx); err != nil {
+			t.Fatalf("StopContext() = %v", err)
+		}
+	}
+	// Give exited goroutines a chance to be cleaned up.
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines leaked", n-before)
+	}
+}
@@ -0,0 +1,141 @@
+package ct
+
+import (
+	"context"
+	"time"
+)
+
+// A Schedule holds a channel that delivers ticks at the times given by a cron
+// expression. Like a Ticker, its channel is closed on Stop.
+type Schedule struct {
+	cron    *Cron
+	c       chan time.Time
+	stop    *stopper
+	clock   Clock
+	catchUp CatchUp
+}
+
+// CatchUp determines what a Schedule does when it falls behind, i.e. when a
+// tick becomes due while an earlier one was not received yet. That happens if
+// the receiver is too slow, or if the process was suspended (e.g. by putting
+// the machine to sleep).
+type CatchUp int
+
+const (
+	// CatchUpLatest delivers only the latest tick that is due.
+	CatchUpLatest CatchUp = iota
+	// CatchUpAll delivers all ticks that are due, in order.
+	CatchUpAll
+	// CatchUpNone drops all ticks that are due and waits for the next one.
+	CatchUpNone
+)
+
+// ScheduleOptions contain optional configuration for a Schedule.
+type ScheduleOptions struct {
+	// Location the cron expression is interpreted in. If nil, time.Local is
+	// used.
+	Location *time.Location
+
+	// CatchUp is the policy for missed ticks.
+	CatchUp CatchUp
+
+	// Clock, if not nil, is used instead of RealClock.
+	Clock Clock
+}
+
+// NewSchedule parses the cron expression expr (see Cron) and returns a
+// Schedule delivering its ticks. The value sent is the time the tick was
+// scheduled for. Stop the schedule to release associated resources.
+func NewSchedule(expr string, o ScheduleOptions) (*Schedule, error) {
+	cron, err := ParseCron(expr, o.Location)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schedule{
+		cron:    cron,
+		c:       make(chan time.Time),
+		stop:    newStopper(),
+		clock:   o.Clock,
+		catchUp: o.CatchUp,
+	}
+	if s.clock == nil {
+		s.clock = RealClock
+	}
+	go s.run()
+	return s, nil
+}
+
+// run delivers ticks, until the schedule is stopped.
+func (s *Schedule) run() {
+	now := s.clock.Now()
+	next := s.cron.Next(now)
+	timer := s.clock.NewTimer(next.Sub(now))
+	defer timer.Stop()
+	var (
+		pending time.Time
+		out     chan time.Time
+	)
+	for {
+		var tick <-chan time.Time
+		if !next.IsZero() && (out == nil || s.catchUp != CatchUpAll) {
+			tick = timer.C()
+		}
+		select {
+		case <-tick:
+			now := s.clock.Now()
+			if next.After(now) {
+				timer.Reset(next.Sub(now))
+				continue
+			}
+			missed := out != nil
+			if s.catchUp != CatchUpAll {
+				for n := s.cron.Next(next); !n.IsZero() && !n.After(now); n = s.cron.Next(n) {
+					next, missed = n, true
+				}
+			}
+			if missed && s.catchUp == CatchUpNone {
+				out = nil
+			} else {
+				pending, out = next, s.c
+			}
+			if next = s.cron.Next(next); !next.IsZero() {
+				timer.Reset(next.Sub(now))
+			}
+		case out <- pending:
+			out = nil
+		case <-s.stop.done:
+			close(s.c)
+			close(s.stop.exited)
+			return
+		}
+	}
+}
+
+// C returns the channel where ticks are delivered.
+func (s *Schedule) C() <-chan time.Time {
+	return s.c
+}
+
+// Next returns the first time after t the schedule ticks at. See Cron.Next.
+func (s *Schedule) Next(t time.Time) time.Time {
+	return s.cron.Next(t)
+}
+
+// Stop turns off a schedule. After Stop, no more ticks will be sent. Stop
+// closes the channel, so you can range over it. Stop may be called multiple
+// times and from any goroutine.
+func (s *Schedule) Stop() {
+	s.stop.stop()
+}
+
+// Done returns a channel that is closed when Stop is called.
+func (s *Schedule) Done() <-chan struct{} {
+	return s.stop.done
+}
+
+// StopContext stops the schedule, like Stop, and waits for its channel to be
+// closed. If ctx is done first, it returns ctx.Err().
+func (s *Schedule) StopContext(ctx context.Context) error {
+	s.stop.stop()
+	return s.stop.wait(ctx)
+}
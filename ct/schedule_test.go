@@ -0,0 +1,97 @@
+package ct
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestSchedule(t *testing.T, cu CatchUp) (*Schedule, *FakeClock) {
+	t.Helper()
+	c := NewFakeClock(epoch)
+	s, err := NewSchedule("* * * * *", ScheduleOptions{
+		Location: time.UTC,
+		CatchUp:  cu,
+		Clock:    c,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.BlockUntil(1)
+	return s, c
+}
+
+func expectTicks(t *testing.T, s *Schedule, want ...time.Duration) {
+	t.Helper()
+	for _, d := range want {
+		if got, want := <-s.C(), epoch.Add(d); !got.Equal(want) {
+			t.Errorf("tick = %v, want %v", got, want)
+		}
+	}
+	select {
+	case ti := <-s.C():
+		t.Errorf("unexpected tick %v", ti)
+	default:
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	s, c := newTestSchedule(t, CatchUpLatest)
+	if got, want := s.Next(epoch), epoch.Add(time.Minute); !got.Equal(want) {
+		t.Errorf("Next() = %v, want %v", got, want)
+	}
+	c.Advance(time.Minute)
+	expectTicks(t, s, time.Minute)
+	s.Stop()
+	s.Stop()
+	<-s.Done()
+	for range s.C() {
+		t.Error("tick after Stop")
+	}
+	if err := s.StopContext(context.Background()); err != nil {
+		t.Errorf("StopContext() = %v", err)
+	}
+}
+
+func TestScheduleCatchUpLatest(t *testing.T) {
+	s, c := newTestSchedule(t, CatchUpLatest)
+	defer s.Stop()
+
+	c.Advance(3 * time.Minute)
+	c.BlockUntil(1)
+	expectTicks(t, s, 3*time.Minute)
+
+	// Slow receiver.
+	c.Advance(time.Minute)
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	c.BlockUntil(1)
+	expectTicks(t, s, 5*time.Minute)
+}
+
+func TestScheduleCatchUpAll(t *testing.T) {
+	s, c := newTestSchedule(t, CatchUpAll)
+	defer s.Stop()
+
+	c.Advance(3 * time.Minute)
+	expectTicks(t, s, time.Minute, 2*time.Minute, 3*time.Minute)
+}
+
+func TestScheduleCatchUpNone(t *testing.T) {
+	s, c := newTestSchedule(t, CatchUpNone)
+	defer s.Stop()
+
+	c.Advance(3 * time.Minute)
+	c.BlockUntil(1)
+	expectTicks(t, s)
+	c.Advance(time.Minute)
+	c.BlockUntil(1)
+	expectTicks(t, s, 4*time.Minute)
+
+	// Slow receiver.
+	c.Advance(time.Minute)
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	c.BlockUntil(1)
+	expectTicks(t, s)
+}
@@ -0,0 +1,145 @@
+package ct
+
+import (
+	"sync"
+	"time"
+)
+
+// A Timer delivers a single event on a channel, which is closed afterwards.
+// Unlike a time.Timer, it is closed on Stop as well, so waiting goroutines
+// don't leak. All methods are safe for concurrent use.
+type Timer struct {
+	clock Clock
+	f     func()
+
+	mu    sync.Mutex
+	c     chan time.Time
+	stop  chan struct{}
+	fired bool
+}
+
+// TimerOptions contain optional configuration for a Timer.
+type TimerOptions struct {
+	// Func, if not nil, is called in its own goroutine when the timer fires.
+	// No value is sent on the channel of the Timer, it is closed when Func
+	// returns.
+	Func func()
+
+	// Clock, if not nil, is used instead of RealClock.
+	Clock Clock
+}
+
+// NewTimer creates a new Timer that will send the current time on its channel
+// after at least duration d and then close it.
+func NewTimer(d time.Duration) *Timer {
+	return NewTimerWithOptions(d, TimerOptions{})
+}
+
+// AfterFunc waits for the duration to elapse and then calls f in its own
+// goroutine. The channel of the returned Timer is closed when f returns or
+// the Timer is stopped.
+func AfterFunc(d time.Duration, f func()) *Timer {
+	return NewTimerWithOptions(d, TimerOptions{Func: f})
+}
+
+// NewTimerWithOptions is like NewTimer, but configures the Timer with o.
+func NewTimerWithOptions(d time.Duration, o TimerOptions) *Timer {
+	t := &Timer{
+		clock: o.Clock,
+		f:     o.Func,
+		c:     make(chan time.Time, 1),
+	}
+	if t.clock == nil {
+		t.clock = RealClock
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.arm(d)
+	return t
+}
+
+// arm starts the timer with duration d. t.mu must be held.
+func (t *Timer) arm(d time.Duration) {
+	stop := make(chan struct{})
+	t.stop, t.fired = stop, false
+	timer := t.clock.NewTimer(d)
+	go func() {
+		select {
+		case now := <-timer.C():
+			t.fire(stop, now)
+		case <-stop:
+			timer.Stop()
+		}
+	}()
+}
+
+// fire is called when the timer armed with stop fires.
+func (t *Timer) fire(stop chan struct{}, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop != stop {
+		// Stopped or reset concurrently.
+		return
+	}
+	t.stop, t.fired = nil, true
+	c := t.c
+	if t.f == nil {
+		c <- now
+		close(c)
+		return
+	}
+	go func() {
+		defer close(c)
+		t.f()
+	}()
+}
+
+// C returns the channel where the event is delivered. It is closed after the
+// timer fired or is stopped. Reset replaces the channel, if it was closed.
+func (t *Timer) C() <-chan time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.c
+}
+
+// Stop prevents the Timer from firing and closes its channel. It returns true
+// if the call stops the timer, false if the timer has already fired or been
+// stopped.
+func (t *Timer) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stop == nil {
+		return false
+	}
+	close(t.stop)
+	t.stop = nil
+	close(t.c)
+	return true
+}
+
+// Reset changes the timer to fire after duration d. It returns true if the
+// timer had been active, false if the timer had fired or been stopped.
+//
+// If the timer had fired or been stopped, its channel is replaced by a new
+// one, so there is no need to drain it and no stale value can be received.
+// Otherwise, the channel is kept.
+func (t *Timer) Reset(d time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := t.stop != nil
+	if active {
+		close(t.stop)
+	} else {
+		t.c = make(chan time.Time, 1)
+	}
+	t.arm(d)
+	return active
+}
+
+// Fired reports whether the timer fired since it was created or last Reset.
+// For a timer created by AfterFunc, this means that f was called.
+func (t *Timer) Fired() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.fired
+}
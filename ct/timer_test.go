@@ -0,0 +1,107 @@
+package ct
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTimer(t *testing.T) {
+	c := NewFakeClock(epoch)
+	tm := NewTimerWithOptions(time.Second, TimerOptions{Clock: c})
+
+	ch := tm.C()
+	c.Advance(time.Second)
+	if got, want := <-ch, epoch.Add(time.Second); !got.Equal(want) {
+		t.Errorf("timer = %v, want %v", got, want)
+	}
+	if _, ok := <-ch; ok {
+		t.Error("channel not closed after firing")
+	}
+	if !tm.Fired() {
+		t.Error("Fired() = false after firing")
+	}
+	if tm.Stop() {
+		t.Error("Stop() = true after firing")
+	}
+
+	if tm.Reset(time.Second) {
+		t.Error("Reset() = true after firing")
+	}
+	if tm.C() == ch {
+		t.Error("Reset did not replace closed channel")
+	}
+	if tm.Fired() {
+		t.Error("Fired() = true after Reset")
+	}
+	ch = tm.C()
+	if !tm.Reset(time.Minute) {
+		t.Error("Reset() = false on active timer")
+	}
+	if tm.C() != ch {
+		t.Error("Reset replaced channel of active timer")
+	}
+	c.Advance(time.Second)
+	if !tm.Stop() {
+		t.Error("Stop() = false on active timer")
+	}
+	if _, ok := <-ch; ok {
+		t.Error("stopped timer fired")
+	}
+	c.Advance(time.Hour)
+	if tm.Fired() {
+		t.Error("stopped timer fired")
+	}
+}
+
+func TestAfterFunc(t *testing.T) {
+	c := NewFakeClock(epoch)
+	var ran bool
+	tm := NewTimerWithOptions(time.Second, TimerOptions{
+		Clock: c,
+		Func:  func() { ran = true },
+	})
+	c.Advance(time.Second)
+	if _, ok := <-tm.C(); ok {
+		t.Error("AfterFunc sent a value")
+	}
+	if !ran || !tm.Fired() {
+		t.Errorf("ran = %v, Fired() = %v, want true, true", ran, tm.Fired())
+	}
+
+	tm = AfterFunc(time.Hour, func() { t.Error("stopped AfterFunc ran") })
+	if !tm.Stop() {
+		t.Error("Stop() = false on active timer")
+	}
+	<-tm.C()
+	if tm.Fired() {
+		t.Error("Fired() = true after Stop")
+	}
+}
+
+func TestTimerConcurrent(t *testing.T) {
+	tm := NewTimer(time.Microsecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ch := tm.C()
+				if j%2 == 0 {
+					tm.Stop()
+				} else {
+					tm.Reset(time.Microsecond)
+				}
+				select {
+				case <-ch:
+				case <-time.After(time.Second):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	tm.Stop()
+	for range tm.C() {
+	}
+}
@@ -0,0 +1,182 @@
+package gjsfs
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"net/http"
+	"path"
+	"sync"
+
+	gbuild "github.com/gopherjs/gopherjs/build"
+	gcompiler "github.com/gopherjs/gopherjs/compiler"
+	"github.com/neelance/sourcemap"
+)
+
+// compiler deduplicates and limits compilations of the files in fs.
+type compiler struct {
+	fs  http.FileSystem
+	sem chan struct{}
+	// build compiles the Go file name, read from r, to JavaScript written
+	// to w.
+	build func(name string, r io.Reader, w io.Writer) error
+
+	mtx    sync.Mutex
+	builds map[string]*build
+}
+
+// build is a single, possibly in-flight, compilation shared by all requests
+// for the same file.
+type build struct {
+	done    chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int
+	// running is set once the build got a slot and can not be cancelled
+	// anymore.
+	running bool
+
+	buf []byte
+	err error
+}
+
+func newCompiler(fs http.FileSystem, max int) *compiler {
+	c := &compiler{
+		fs:     fs,
+		build:  gopherjsBuild,
+		builds: make(map[string]*build),
+	}
+	if max > 0 {
+		c.sem = make(chan struct{}, max)
+	}
+	return c
+}
+
+// compile compiles the .go file name. If a compilation of name is already in
+// flight, it waits for that instead of starting a new one. If ctx is
+// cancelled, compile gives up waiting. If all waiters gave up, a compilation
+// still queued for a slot is dropped; GopherJS can not be interrupted, so
+// a running one finishes anyway and later requests still wait for it.
+func (c *compiler) compile(ctx context.Context, name string) ([]byte, error) {
+	c.mtx.Lock()
+	b, ok := c.builds[name]
+	if !ok {
+		b = &build{done: make(chan struct{})}
+		b.ctx, b.cancel = context.WithCancel(context.Background())
+		c.builds[name] = b
+		go c.run(name, b)
+	}
+	b.waiters++
+	c.mtx.Unlock()
+
+	select {
+	case <-b.done:
+		return b.buf, b.err
+	case <-ctx.Done():
+		c.mtx.Lock()
+		if b.waiters--; b.waiters == 0 && !b.running {
+			b.cancel()
+			c.remove(name, b)
+		}
+		c.mtx.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// run runs the build b of name, as soon as a slot is available.
+func (c *compiler) run(name string, b *build) {
+	defer close(b.done)
+	defer b.cancel()
+	defer func() {
+		c.mtx.Lock()
+		c.remove(name, b)
+		c.mtx.Unlock()
+	}()
+
+	if c.sem != nil {
+		select {
+		case c.sem <- struct{}{}:
+			defer func() { <-c.sem }()
+		case <-b.ctx.Done():
+		}
+	}
+	c.mtx.Lock()
+	err := b.ctx.Err()
+	b.running = err == nil
+	c.mtx.Unlock()
+	if err != nil {
+		Log.Printf("Compilation of %q abandoned", name)
+		b.err = err
+		return
+	}
+
+	f, err := c.fs.Open(name)
+	if err != nil {
+		b.err = err
+		return
+	}
+	defer f.Close()
+
+	Log.Printf("Compiling %q…", name)
+	defer Log.Printf("Compilation of %q finished", name)
+
+	buf := new(bytes.Buffer)
+	if err := c.build(name, f, buf); err != nil {
+		Log.Printf("Compilation failed: %v", err)
+		b.err = err
+		return
+	}
+	b.buf = buf.Bytes()
+}
+
+// remove removes b from the in-flight builds, unless it has already been
+// replaced. c.mtx must be held.
+func (c *compiler) remove(name string, b *build) {
+	if c.builds[name] == b {
+		delete(c.builds, name)
+	}
+}
+
+func gopherjsBuild(name string, r io.Reader, w io.Writer) error {
+	return Compile(name, r, w, nil)
+}
+
+// Compile compiles the Go file name, read from src, as a main package to
+// minified JavaScript written to w. It is the compilation gjsfs serves name
+// with, so tools like gjsfs-export can produce the same code. If m is not nil,
+// a source map of the code is recorded in it, which refers to the file by its
+// base name.
+func Compile(name string, src io.Reader, w io.Writer, m *sourcemap.Map) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path.Base(name), src, 0)
+	if err != nil {
+		return err
+	}
+
+	o := &gbuild.Options{Minify: true}
+	s, err := gbuild.NewSession(o)
+	if err != nil {
+		return err
+	}
+	ctx := &gcompiler.ImportContext{
+		Packages: s.Types,
+		Import:   s.BuildImportPath,
+	}
+	archive, err := gcompiler.Compile("main", []*ast.File{f}, fset, ctx, o.Minify)
+	if err != nil {
+		return err
+	}
+	deps, err := gcompiler.ImportDependencies(archive, s.BuildImportPath)
+	if err != nil {
+		return err
+	}
+
+	sw := &gcompiler.SourceMapFilter{Writer: w}
+	if m != nil {
+		sw.MappingCallback = gbuild.NewMappingCallback(m, o.GOROOT, o.GOPATH, false)
+	}
+	return gcompiler.WriteProgramCode(deps, sw, s.GoRelease())
+}
@@ -0,0 +1,180 @@
+package gjsfs
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func init() {
+	Log.SetOutput(io.Discard)
+}
+
+// stubBuild replaces Compile in tests. Every build signals on started and
+// blocks until released.
+type stubBuild struct {
+	calls   int32
+	started chan string
+	release chan struct{}
+}
+
+func newStubCompiler(t *testing.T, max int, files ...string) (*compiler, *stubBuild) {
+	dir := t.TempDir()
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("package main // "+f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &stubBuild{
+		started: make(chan string, 10),
+		release: make(chan struct{}),
+	}
+	c := newCompiler(http.Dir(dir), max)
+	c.build = func(name string, r io.Reader, w io.Writer) error {
+		atomic.AddInt32(&s.calls, 1)
+		src, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		s.started <- string(src)
+		<-s.release
+		_, err = w.Write(src)
+		return err
+	}
+	return c, s
+}
+
+func (s *stubBuild) expectStart(t *testing.T, want string) {
+	t.Helper()
+	select {
+	case got := <-s.started:
+		if got != want {
+			t.Fatalf("started build of %q, want %q", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("build of %q not started", want)
+	}
+}
+
+func (s *stubBuild) expectNoStart(t *testing.T) {
+	t.Helper()
+	select {
+	case got := <-s.started:
+		t.Fatalf("unexpected build of %q", got)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+// waitForWaiters waits for n requests to wait for the build of name.
+func waitForWaiters(t *testing.T, c *compiler, name string, n int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		c.mtx.Lock()
+		b := c.builds[name]
+		ok := b != nil && b.waiters == n
+		c.mtx.Unlock()
+		if ok {
+			return
+		}
+	}
+	t.Fatalf("%d requests for %q not waiting", n, name)
+}
+
+func TestCompileDedup(t *testing.T) {
+	c, s := newStubCompiler(t, 0, "a.go")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf, err := c.compile(context.Background(), "/a.go")
+			if err != nil || string(buf) != "package main // a.go" {
+				t.Errorf("compile() = %q, %v", buf, err)
+			}
+		}()
+	}
+	s.expectStart(t, "package main // a.go")
+	waitForWaiters(t, c, "/a.go", 5)
+	close(s.release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&s.calls); n != 1 {
+		t.Errorf("%d builds, want 1", n)
+	}
+}
+
+func TestCompileQueue(t *testing.T) {
+	c, s := newStubCompiler(t, 1, "a.go", "b.go")
+
+	errs := make(chan error, 2)
+	for _, name := range []string{"/a.go", "/b.go"} {
+		name := name
+		go func() {
+			_, err := c.compile(context.Background(), name)
+			errs <- err
+		}()
+		if name == "/a.go" {
+			s.expectStart(t, "package main // a.go")
+		}
+	}
+	// b.go waits for a slot.
+	s.expectNoStart(t)
+	s.release <- struct{}{}
+	s.expectStart(t, "package main // b.go")
+	s.release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("compile() = %v", err)
+		}
+	}
+}
+
+func TestCompileCancel(t *testing.T) {
+	c, s := newStubCompiler(t, 1, "a.go", "b.go")
+
+	// A cancelled request for a running build leaves it running, for later
+	// requests to join.
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := c.compile(ctx, "/a.go")
+		errs <- err
+	}()
+	s.expectStart(t, "package main // a.go")
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("compile() = %v, want %v", err, context.Canceled)
+	}
+
+	// A cancelled request for a queued build drops it.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.compile(ctx, "/b.go"); err != context.DeadlineExceeded {
+		t.Errorf("compile() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if buf, err := c.compile(context.Background(), "/a.go"); err != nil || string(buf) != "package main // a.go" {
+			t.Errorf("compile() = %q, %v", buf, err)
+		}
+	}()
+	waitForWaiters(t, c, "/a.go", 1)
+	s.expectNoStart(t)
+	s.release <- struct{}{}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("request did not join the running build")
+	}
+	if n := atomic.LoadInt32(&s.calls); n != 1 {
+		t.Errorf("%d builds, want 1", n)
+	}
+}
@@ -1,15 +1,22 @@
 // Package gjsfs implements an http.FileSystem for gopherjs compiled files
+//
+// Files are compiled with GopherJS 1.17, which needs a Go 1.17 distribution to
+// compile against. If the default GOROOT has a different version, set
+// GOPHERJS_GOROOT to one.
 package gjsfs
 
 import (
 	"bytes"
+	"context"
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path"
-
-	"github.com/shurcooL/gopherjslib"
+	"strings"
 )
 
 var Log = log.New(os.Stderr, "[gjsfs]", log.LstdFlags)
@@ -17,14 +24,82 @@ var Log = log.New(os.Stderr, "[gjsfs]", log.LstdFlags)
 // New returns a http.FileSystem that wraps fs. All .js files opened are
 // rewritten to .go names and - if existent in fs - compiled when read. All
 // other files are passed through verbatim.
+//
+// Concurrent reads of the same .js file share a single compilation.
 func New(fs http.FileSystem) http.FileSystem {
-	return fileSystem{fs}
+	return NewWithOptions(fs, Options{})
+}
+
+// Options restrict what a http.FileSystem returned by NewWithOptions exposes.
+// The zero value exposes everything, like New.
+type Options struct {
+	// EntryPoints, if not empty, is the list of .go files (as absolute,
+	// slash-separated paths in fs) that may be compiled.
+	EntryPoints []string
+
+	// Tag, if not empty, restricts compilation to .go files with a build
+	// constraint requiring Tag (e.g. "//go:build gjsfs").
+	Tag string
+
+	// Marker, if not empty, restricts compilation to .go files containing
+	// Marker as a line comment before the package clause (e.g.
+	// "//gjsfs:entry").
+	Marker string
+
+	// HideSources hides all .go files. Entry points can still be opened by
+	// their .js name.
+	HideSources bool
+
+	// Export, if not nil, is called with the name of every file and
+	// directory that is neither a .go nor a .js file. Only files it returns
+	// true for are exposed. .js files are omitted from directory listings.
+	Export func(name string) bool
+
+	// MaxCompiles, if positive, limits the number of concurrent
+	// compilations. Further compilations are queued.
+	MaxCompiles int
+}
+
+// NewWithOptions is like New, but only exposes the files allowed by o. All
+// other files (and .js files whose .go files are not entry points) can not be
+// opened and are omitted from directory listings, so a http.FileServer will
+// serve a 404 for them.
+func NewWithOptions(fs http.FileSystem, o Options) http.FileSystem {
+	if len(o.EntryPoints) > 0 {
+		eps := make([]string, len(o.EntryPoints))
+		for i, ep := range o.EntryPoints {
+			eps[i] = cleanPath(ep)
+		}
+		o.EntryPoints = eps
+	}
+	return fileSystem{fs: fs, o: o, c: newCompiler(fs, o.MaxCompiles)}
+}
+
+// WithContext returns a view of fs, which gives up waiting for compilations
+// when ctx is cancelled. If fs was not returned by New or NewWithOptions, it
+// is returned unchanged.
+func WithContext(ctx context.Context, fs http.FileSystem) http.FileSystem {
+	if gfs, ok := fs.(fileSystem); ok {
+		gfs.ctx = ctx
+		return gfs
+	}
+	return fs
+}
+
+// FileServer is like http.FileServer, but waits for compilations only as long
+// as the request context is not cancelled.
+func FileServer(fs http.FileSystem) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.FileServer(WithContext(r.Context(), fs)).ServeHTTP(w, r)
+	})
 }
 
 type file struct {
 	r    io.ReadSeeker
 	size int64
 	f    http.File
+	name string
+	fs   fileSystem
 }
 
 func (f *file) compile() error {
@@ -32,17 +107,16 @@ func (f *file) compile() error {
 		return nil
 	}
 
-	Log.Println("Compiling…")
-	defer Log.Println("Compilation finished")
-
-	buf := new(bytes.Buffer)
-	err := gopherjslib.Build(f.f, buf, &gopherjslib.Options{Minify: true})
+	ctx := f.fs.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	buf, err := f.fs.c.compile(ctx, f.name)
 	if err != nil {
-		Log.Printf("Compilation failed: %v", err)
 		return err
 	}
-	f.r = bytes.NewReader(buf.Bytes())
-	f.size = int64(len(buf.Bytes()))
+	f.r = bytes.NewReader(buf)
+	f.size = int64(len(buf))
 	return nil
 }
 
@@ -56,10 +130,7 @@ func (f *file) Read(buf []byte) (n int, err error) {
 }
 
 func (f *file) Close() error {
-	if c, ok := f.r.(io.Closer); ok {
-		return c.Close()
-	}
-	return nil
+	return f.f.Close()
 }
 
 func (f *file) Readdir(count int) ([]os.FileInfo, error) {
@@ -105,33 +176,166 @@ func (f *file) Stat() (os.FileInfo, error) {
 }
 
 type fileSystem struct {
-	fs http.FileSystem
+	fs  http.FileSystem
+	o   Options
+	c   *compiler
+	ctx context.Context
 }
 
 func (fs fileSystem) Open(name string) (http.File, error) {
 	Log.Printf("Open(%q)", name)
-	if path.Ext(name) != ".js" {
+	// Policies are checked on the cleaned name, so that e.g. "/app.go/" is
+	// treated like "/app.go". Extensions are compared case-insensitively, as
+	// fs might be case-insensitive.
+	name = cleanPath(name)
+	if !hasExt(name, ".js") {
+		if !fs.exported(name) {
+			Log.Println("Not exported")
+			return nil, os.ErrNotExist
+		}
 		Log.Println("Not a javascript file, passing through")
-		return fs.fs.Open(name)
+		f, err := fs.fs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		return dir{f, fs, name}, nil
 	}
 	name = name[:len(name)-2] + "go"
 
 	f, err := fs.fs.Open(name)
 	if err != nil {
-		Log.Println("Could not open: %v", err)
+		Log.Printf("Could not open: %v", err)
 		return nil, err
 	}
 
+	// Only files can be compiled. Anything else must not be served under the
+	// .js name, as that would bypass the policy checks.
 	fi, err := f.Stat()
 	if err != nil {
-		Log.Println("Could not stat: %v", err)
-		return f, nil
+		Log.Printf("Could not stat: %v", err)
+		f.Close()
+		return nil, os.ErrNotExist
 	}
 
 	if fi.IsDir() {
 		Log.Println("Is directory, skipping")
-		return f, nil
+		f.Close()
+		return nil, os.ErrNotExist
+	}
+
+	if !fs.isEntryPoint(name, f) {
+		Log.Println("Not an entry point")
+		f.Close()
+		return nil, os.ErrNotExist
 	}
 
-	return &file{f: f}, nil
+	return &file{f: f, name: name, fs: fs}, nil
+}
+
+// cleanPath returns the canonical form of name, as used by http.Dir.
+func cleanPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// hasExt returns whether name has the extension ext, ignoring case.
+func hasExt(name, ext string) bool {
+	return strings.EqualFold(path.Ext(name), ext)
+}
+
+// exported returns whether name, which is not a .js file, is exposed.
+func (fs fileSystem) exported(name string) bool {
+	if hasExt(name, ".go") {
+		return !fs.o.HideSources
+	}
+	return fs.o.Export == nil || fs.o.Export(name)
+}
+
+// isEntryPoint returns whether the .go file name, opened as f, may be
+// compiled. f is rewound afterwards.
+func (fs fileSystem) isEntryPoint(name string, f http.File) bool {
+	o := fs.o
+	if len(o.EntryPoints) > 0 && !contains(o.EntryPoints, name) {
+		return false
+	}
+	if o.Tag == "" && o.Marker == "" {
+		return true
+	}
+
+	src, err := io.ReadAll(f)
+	if _, serr := f.Seek(0, io.SeekStart); err == nil {
+		err = serr
+	}
+	if err != nil {
+		Log.Printf("Could not read: %v", err)
+		return false
+	}
+	af, err := parser.ParseFile(token.NewFileSet(), name, src, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		Log.Printf("Could not parse: %v", err)
+		return false
+	}
+
+	tagged, marked := o.Tag == "", o.Marker == ""
+	for _, g := range af.Comments {
+		if g.Pos() > af.Package {
+			break
+		}
+		for _, c := range g.List {
+			if c.Text == o.Marker {
+				marked = true
+			}
+			if o.Tag != "" && requiresTag(c.Text, o.Tag) {
+				tagged = true
+			}
+		}
+	}
+	return tagged && marked
+}
+
+// requiresTag returns whether line is a build constraint that is only
+// satisfied if tag is set.
+func requiresTag(line, tag string) bool {
+	if !constraint.IsGoBuild(line) && !constraint.IsPlusBuild(line) {
+		return false
+	}
+	expr, err := constraint.Parse(line)
+	if err != nil {
+		return false
+	}
+	with := expr.Eval(func(t string) bool { return t == tag || t == "js" })
+	without := expr.Eval(func(t string) bool { return t == "js" })
+	return with && !without
+}
+
+func contains(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// dir wraps a passed through file, to omit unexposed files from directory
+// listings.
+type dir struct {
+	http.File
+	fs   fileSystem
+	name string
+}
+
+func (d dir) Readdir(count int) ([]os.FileInfo, error) {
+	fis, err := d.File.Readdir(count)
+	if !d.fs.o.HideSources && d.fs.o.Export == nil {
+		return fis, err
+	}
+
+	var out []os.FileInfo
+	for _, fi := range fis {
+		name := path.Join(d.name, fi.Name())
+		if !hasExt(name, ".js") && d.fs.exported(name) {
+			out = append(out, fi)
+		}
+	}
+	return out, err
 }
@@ -0,0 +1,83 @@
+package gjsfs
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// foldFS is a case-insensitive http.FileSystem. Files named broken.go can't
+// be stat'ed.
+type foldFS struct {
+	http.Dir
+}
+
+func (fs foldFS) Open(name string) (http.File, error) {
+	f, err := fs.Dir.Open(strings.ToLower(name))
+	if err == nil && path.Base(name) == "broken.go" {
+		return brokenFile{f}, nil
+	}
+	return f, err
+}
+
+type brokenFile struct {
+	http.File
+}
+
+func (brokenFile) Stat() (os.FileInfo, error) {
+	return nil, errors.New("broken")
+}
+
+func TestHideSources(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"app.go", "broken.go", "style.css", "pkg.go/secret.go", "pkg.go/private.txt"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, f), []byte("package main"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs := NewWithOptions(foldFS{http.Dir(dir)}, Options{
+		EntryPoints: []string{"/./app.go", "/broken.go"},
+		HideSources: true,
+	})
+
+	// pkg.js maps to a directory, which must not be listed under that name,
+	// and broken.js must not serve the source.
+	for _, name := range []string{"/app.go", "app.go", "/app.go/", "/./app.go", "/APP.GO", "/app.Go", "/pkg.js", "/pkg.js/", "/broken.js"} {
+		if f, err := fs.Open(name); err == nil {
+			f.Close()
+			t.Errorf("Open(%q) succeeded, want hidden", name)
+		}
+	}
+	for _, name := range []string{"/app.js", "/style.css", "/"} {
+		f, err := fs.Open(name)
+		if err != nil {
+			t.Errorf("Open(%q) = %v", name, err)
+			continue
+		}
+		f.Close()
+	}
+
+	d, err := fs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 1 || fis[0].Name() != "style.css" {
+		var names []string
+		for _, fi := range fis {
+			names = append(names, fi.Name())
+		}
+		t.Errorf("Readdir() = %q, want [style.css]", names)
+	}
+}
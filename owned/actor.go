@@ -0,0 +1,218 @@
+package owned
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrMailboxFull is returned when sending to an Actor with a full
+	// mailbox and the Fail overflow policy.
+	ErrMailboxFull = errors.New("owned: mailbox is full")
+
+	// ErrDropped is returned by Ask, if the message was dropped from the
+	// mailbox by the DropOldest overflow policy.
+	ErrDropped = errors.New("owned: message was dropped")
+)
+
+// Overflow is the policy applied by an Actor when its mailbox is full.
+type Overflow int
+
+const (
+	// Block blocks the sender until there is room in the mailbox.
+	Block Overflow = iota
+	// DropOldest drops the oldest message in the mailbox.
+	DropOldest
+	// Fail fails the send with ErrMailboxFull.
+	Fail
+)
+
+// ActorOptions contain optional configuration for an Actor.
+type ActorOptions struct {
+	// MailboxSize is the number of messages the mailbox can hold. If zero,
+	// a default size is used.
+	MailboxSize int
+
+	// Overflow is the policy applied when the mailbox is full.
+	Overflow Overflow
+
+	// Options configure the Of holding the state.
+	Options Options
+}
+
+// Actor is an owned state of type S, which is modified by messages of type M,
+// each producing a reply of type R. Messages are handled one at a time, in
+// the order they are received.
+type Actor[S, M, R any] struct {
+	state    *Of[S]
+	handler  func(S, M) (S, R)
+	mailbox  chan envelope[M, R]
+	overflow Overflow
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+type envelope[M, R any] struct {
+	msg   M
+	reply chan actorReply[R]
+}
+
+type actorReply[R any] struct {
+	r   R
+	err error
+}
+
+// NewActor returns a new Actor with initial state s, which handles messages
+// with handler. Close it to stop the owning goroutines.
+func NewActor[S, M, R any](s S, handler func(state S, msg M) (S, R), opts ActorOptions) *Actor[S, M, R] {
+	size := opts.MailboxSize
+	if size == 0 {
+		size = mailboxSize
+	}
+	a := &Actor[S, M, R]{
+		state:    NewOfWithOptions(s, opts.Options),
+		handler:  handler,
+		mailbox:  make(chan envelope[M, R], size),
+		overflow: opts.Overflow,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go a.loop()
+	return a
+}
+
+// loop handles all messages, until a is closed.
+func (a *Actor[S, M, R]) loop() {
+	defer close(a.stopped)
+	defer a.state.Close()
+	for {
+		select {
+		case e := <-a.mailbox:
+			a.handle(e)
+		case <-a.done:
+			// Handle messages that are already pending.
+			for {
+				select {
+				case e := <-a.mailbox:
+					a.handle(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// handle applies the handler to e and sends the reply, if requested.
+func (a *Actor[S, M, R]) handle(e envelope[M, R]) {
+	var r R
+	err := a.state.DoContext(context.Background(), func(s S) S {
+		s, r = a.handler(s, e.msg)
+		return s
+	})
+	if e.reply != nil {
+		e.reply <- actorReply[R]{r, err}
+	}
+}
+
+// post puts e into the mailbox, applying the overflow policy.
+func (a *Actor[S, M, R]) post(ctx context.Context, e envelope[M, R]) error {
+	select {
+	case <-a.done:
+		return ErrClosed
+	default:
+	}
+
+	switch a.overflow {
+	case DropOldest:
+		for {
+			select {
+			case a.mailbox <- e:
+				return nil
+			default:
+			}
+			select {
+			case old := <-a.mailbox:
+				if old.reply != nil {
+					old.reply <- actorReply[R]{err: ErrDropped}
+				}
+			default:
+			}
+		}
+	case Fail:
+		select {
+		case a.mailbox <- e:
+			return nil
+		default:
+			return ErrMailboxFull
+		}
+	default:
+		select {
+		case a.mailbox <- e:
+			return nil
+		case <-a.done:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Tell sends msg to a, without waiting for it to be handled. It returns
+// ErrClosed, if a is closed, and ErrMailboxFull, if the mailbox is full and
+// the overflow policy is Fail.
+func (a *Actor[S, M, R]) Tell(msg M) error {
+	return a.post(context.Background(), envelope[M, R]{msg: msg})
+}
+
+// Ask sends msg to a and returns the reply of the handler. It gives up if ctx
+// is cancelled first, but the message might still be handled. It returns
+// ErrClosed, if a is closed, ErrMailboxFull or ErrDropped, if the message
+// could not be delivered, and a *PanicError, if the handler panics.
+func (a *Actor[S, M, R]) Ask(ctx context.Context, msg M) (R, error) {
+	var zero R
+
+	reply := make(chan actorReply[R], 1)
+	if err := a.post(ctx, envelope[M, R]{msg, reply}); err != nil {
+		return zero, err
+	}
+
+	select {
+	case rep := <-reply:
+		return rep.r, rep.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	case <-a.stopped:
+		// msg might have been queued after the mailbox was drained.
+		select {
+		case rep := <-reply:
+			return rep.r, rep.err
+		default:
+			return zero, ErrClosed
+		}
+	}
+}
+
+// State returns the current state of a.
+func (a *Actor[S, M, R]) State() S {
+	return a.state.Get()
+}
+
+// Len returns the number of messages waiting in the mailbox.
+func (a *Actor[S, M, R]) Len() int {
+	return len(a.mailbox)
+}
+
+// Cap returns the capacity of the mailbox.
+func (a *Actor[S, M, R]) Cap() int {
+	return cap(a.mailbox)
+}
+
+// Close stops a, after handling all pending messages. Afterwards, Tell and
+// Ask fail with ErrClosed. Close can be called multiple times.
+func (a *Actor[S, M, R]) Close() {
+	a.once.Do(func() { close(a.done) })
+	<-a.stopped
+}
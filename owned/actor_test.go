@@ -0,0 +1,112 @@
+package owned
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func ExampleActor() {
+	// A bank account, which can't be overdrawn.
+	account := NewActor(0, func(balance int, delta int) (int, error) {
+		if balance+delta < 0 {
+			return balance, fmt.Errorf("insufficient funds: %d", balance)
+		}
+		return balance + delta, nil
+	}, ActorOptions{})
+	defer account.Close()
+
+	account.Tell(100)
+	if reply, _ := account.Ask(context.Background(), -150); reply != nil {
+		fmt.Println(reply)
+	}
+	account.Ask(context.Background(), -30)
+	fmt.Println("Balance:", account.State())
+
+	// Output:
+	// insufficient funds: 100
+	// Balance: 70
+}
+
+// blockedActor returns an Actor with a mailbox of size 1, whose handler
+// blocks until unblock is closed. One message is being handled and the
+// mailbox is filled with a second one. The results of asking them are sent
+// on first and second.
+func blockedActor(t *testing.T, o Overflow) (a *Actor[int, int, int], unblock chan struct{}, first, second <-chan error) {
+	unblock = make(chan struct{})
+	started := make(chan struct{}, 1)
+	a = NewActor(0, func(s, m int) (int, int) {
+		started <- struct{}{}
+		<-unblock
+		return s + m, s + m
+	}, ActorOptions{MailboxSize: 1, Overflow: o})
+
+	ask := func(m int) <-chan error {
+		errc := make(chan error, 1)
+		go func() {
+			_, err := a.Ask(context.Background(), m)
+			errc <- err
+		}()
+		return errc
+	}
+	first = ask(1)
+	<-started
+	second = ask(2)
+	for a.Len() == 0 {
+		runtime.Gosched()
+	}
+	return a, unblock, first, second
+}
+
+func TestActorFail(t *testing.T) {
+	a, unblock, first, second := blockedActor(t, Fail)
+
+	if err := a.Tell(4); err != ErrMailboxFull {
+		t.Errorf("Tell to full mailbox returned %v, expected %v", err, ErrMailboxFull)
+	}
+	close(unblock)
+	for _, c := range []<-chan error{first, second} {
+		if err := <-c; err != nil {
+			t.Error(err)
+		}
+	}
+	if s := a.State(); s != 3 {
+		t.Errorf("a.State() == %d, expected 3", s)
+	}
+	a.Close()
+}
+
+func TestActorDropOldest(t *testing.T) {
+	a, unblock, first, second := blockedActor(t, DropOldest)
+
+	if err := a.Tell(4); err != nil {
+		t.Errorf("Tell to full mailbox returned %v, expected <nil>", err)
+	}
+	if err := <-second; err != ErrDropped {
+		t.Errorf("Ask of dropped message returned %v, expected %v", err, ErrDropped)
+	}
+	close(unblock)
+	if err := <-first; err != nil {
+		t.Error(err)
+	}
+	a.Close()
+	if s := a.State(); s != 0 {
+		t.Errorf("State after Close is %d, expected zero value", s)
+	}
+}
+
+func TestActorClosed(t *testing.T) {
+	a := NewActor(0, func(s, m int) (int, int) {
+		return s + m, s + m
+	}, ActorOptions{})
+	a.Tell(1)
+	a.Close()
+
+	if err := a.Tell(1); err != ErrClosed {
+		t.Errorf("Tell after Close returned %v, expected %v", err, ErrClosed)
+	}
+	if _, err := a.Ask(context.Background(), 1); err != ErrClosed {
+		t.Errorf("Ask after Close returned %v, expected %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,290 @@
+package owned
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAllocs(t *testing.T) {
+	if debugTag {
+		t.Skip("debug mode allocates")
+	}
+	if raceEnabled {
+		t.Skip("the race detector makes sync.Pool allocate")
+	}
+	o := NewOf(0)
+	defer o.Close()
+
+	tcs := []struct {
+		name string
+		f    func()
+	}{
+		{"Get", func() { o.Get() }},
+		{"Set", func() { o.Set(1000) }},
+		{"CAS", func() { o.CAS(1000, 1000) }},
+		{"CASFunc", func() { CAS(o, 1000, 1000) }},
+	}
+	for _, tc := range tcs {
+		if n := testing.AllocsPerRun(100, tc.f); n != 0 {
+			t.Errorf("%s allocates %v times, want 0", tc.name, n)
+		}
+	}
+}
+
+// TestValueAllocs checks that Value does not allocate more than the original
+// design, i.e. a closure and a result channel per operation.
+func TestValueAllocs(t *testing.T) {
+	if debugTag {
+		t.Skip("debug mode allocates")
+	}
+	ch := New(0)
+	defer close(ch)
+
+	tcs := []struct {
+		name string
+		f    func()
+	}{
+		{"Get", func() { ch.Get() }},
+		{"Set", func() { ch.Set(1000) }},
+		{"CAS", func() { ch.CAS(1000, 1000) }},
+	}
+	for _, tc := range tcs {
+		if n := testing.AllocsPerRun(100, tc.f); n > 2 {
+			t.Errorf("%s allocates %v times, want at most 2", tc.name, n)
+		}
+	}
+}
+
+// unbatched is the original design of this package, for comparison: Every
+// operation sends a closure and waits on a new result channel.
+type unbatched chan<- func(int) int
+
+func newUnbatched(v int) unbatched {
+	ch := make(chan func(int) int)
+	go func() {
+		for f := range ch {
+			v = f(v)
+		}
+	}()
+	return ch
+}
+
+func (ch unbatched) Get() int {
+	ret := make(chan int)
+	ch <- func(v int) int {
+		ret <- v
+		return v
+	}
+	return <-ret
+}
+
+func (ch unbatched) Set(to int) int {
+	ret := make(chan int)
+	ch <- func(v int) int {
+		ret <- v
+		return to
+	}
+	return <-ret
+}
+
+func (ch unbatched) CAS(cmp, set int) bool {
+	ret := make(chan bool)
+	ch <- func(v int) int {
+		if v == cmp {
+			ret <- true
+			return set
+		}
+		ret <- false
+		return v
+	}
+	return <-ret
+}
+
+func BenchmarkGet(b *testing.B) {
+	b.Run("Of", func(b *testing.B) {
+		o := NewOf(42)
+		defer o.Close()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				o.Get()
+			}
+		})
+	})
+	b.Run("Value", func(b *testing.B) {
+		v := New(42)
+		defer close(v)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.Get()
+			}
+		})
+	})
+	b.Run("Unbatched", func(b *testing.B) {
+		v := newUnbatched(42)
+		defer close(v)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.Get()
+			}
+		})
+	})
+	b.Run("Mutex", func(b *testing.B) {
+		var mu sync.Mutex
+		v := 42
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				mu.Lock()
+				_ = v
+				mu.Unlock()
+			}
+		})
+	})
+	b.Run("atomic.Value", func(b *testing.B) {
+		var v atomic.Value
+		v.Store(42)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_ = v.Load().(int)
+			}
+		})
+	})
+}
+
+func BenchmarkSet(b *testing.B) {
+	b.Run("Of", func(b *testing.B) {
+		o := NewOf(42)
+		defer o.Close()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				o.Set(23)
+			}
+		})
+	})
+	b.Run("Value", func(b *testing.B) {
+		v := New(42)
+		defer close(v)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.Set(23)
+			}
+		})
+	})
+	b.Run("Unbatched", func(b *testing.B) {
+		v := newUnbatched(42)
+		defer close(v)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.Set(23)
+			}
+		})
+	})
+	b.Run("Mutex", func(b *testing.B) {
+		var mu sync.Mutex
+		v := 42
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				mu.Lock()
+				v = 23
+				mu.Unlock()
+			}
+		})
+		_ = v
+	})
+	b.Run("atomic.Value", func(b *testing.B) {
+		var v atomic.Value
+		v.Store(42)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.Swap(23)
+			}
+		})
+	})
+}
+
+func BenchmarkCAS(b *testing.B) {
+	b.Run("Of", func(b *testing.B) {
+		o := NewOf(42)
+		defer o.Close()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				o.CAS(42, 42)
+			}
+		})
+	})
+	b.Run("Value", func(b *testing.B) {
+		v := New(42)
+		defer close(v)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.CAS(42, 42)
+			}
+		})
+	})
+	b.Run("Unbatched", func(b *testing.B) {
+		v := newUnbatched(42)
+		defer close(v)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.CAS(42, 42)
+			}
+		})
+	})
+	b.Run("Mutex", func(b *testing.B) {
+		var mu sync.Mutex
+		v := 42
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				mu.Lock()
+				if v == 42 {
+					v = 42
+				}
+				mu.Unlock()
+			}
+		})
+	})
+	b.Run("atomic.Value", func(b *testing.B) {
+		var v atomic.Value
+		v.Store(42)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.CompareAndSwap(42, 42)
+			}
+		})
+	})
+}
+
+// BenchmarkContended compares Get with many more goroutines than CPUs, where
+// Of can batch operations.
+func BenchmarkContended(b *testing.B) {
+	b.Run("Of", func(b *testing.B) {
+		o := NewOf(42)
+		defer o.Close()
+		b.SetParallelism(8)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				o.Get()
+			}
+		})
+	})
+	b.Run("Value", func(b *testing.B) {
+		v := New(42)
+		defer close(v)
+		b.SetParallelism(8)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.Get()
+			}
+		})
+	})
+	b.Run("Unbatched", func(b *testing.B) {
+		v := newUnbatched(42)
+		defer close(v)
+		b.SetParallelism(8)
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				v.Get()
+			}
+		})
+	})
+}
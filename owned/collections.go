@@ -0,0 +1,192 @@
+package owned
+
+import "context"
+
+// Map is a map owned by a separate goroutine. All methods are atomic. Only
+// methods modifying the map notify watchers of the underlying value.
+type Map[K comparable, V any] struct {
+	o *Of[map[K]V]
+}
+
+// NewMap returns a new, empty Map. Close it to stop the owning goroutine.
+func NewMap[K comparable, V any]() *Map[K, V] {
+	return &Map[K, V]{NewOf(make(map[K]V))}
+}
+
+// Close stops the owning goroutine. See Of.Close.
+func (m *Map[K, V]) Close() {
+	m.o.Close()
+}
+
+// Load returns the value stored for k and whether it is present.
+func (m *Map[K, V]) Load(k K) (v V, ok bool) {
+	m.o.read(func(mm map[K]V) {
+		v, ok = mm[k]
+	})
+	return v, ok
+}
+
+// Store sets the value for k to v.
+func (m *Map[K, V]) Store(k K, v V) {
+	m.o.Do(func(mm map[K]V) map[K]V {
+		mm[k] = v
+		return mm
+	})
+}
+
+// LoadOrStore returns the value stored for k, if present. Otherwise, it
+// stores and returns v. loaded reports whether the value was present.
+func (m *Map[K, V]) LoadOrStore(k K, v V) (actual V, loaded bool) {
+	m.o.Do(func(mm map[K]V) map[K]V {
+		if actual, loaded = mm[k]; loaded {
+			m.o.unchanged = true
+		} else {
+			mm[k], actual = v, v
+		}
+		return mm
+	})
+	return actual, loaded
+}
+
+// Delete deletes the value for k.
+func (m *Map[K, V]) Delete(k K) {
+	m.o.Do(func(mm map[K]V) map[K]V {
+		if _, ok := mm[k]; !ok {
+			m.o.unchanged = true
+		}
+		delete(mm, k)
+		return mm
+	})
+}
+
+// Len returns the number of entries in m.
+func (m *Map[K, V]) Len() (n int) {
+	m.o.read(func(mm map[K]V) {
+		n = len(mm)
+	})
+	return n
+}
+
+// Snapshot returns a copy of the map, taken atomically.
+func (m *Map[K, V]) Snapshot() map[K]V {
+	var s map[K]V
+	m.o.read(func(mm map[K]V) {
+		s = make(map[K]V, len(mm))
+		for k, v := range mm {
+			s[k] = v
+		}
+	})
+	return s
+}
+
+// Range calls f for every entry of a Snapshot of m, until f returns false.
+// As it works on a snapshot, f can use m.
+func (m *Map[K, V]) Range(f func(k K, v V) bool) {
+	for k, v := range m.Snapshot() {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+// Queue is a FIFO queue owned by a separate goroutine. All methods are
+// atomic.
+type Queue[T any] struct {
+	o *Of[[]T]
+}
+
+// NewQueue returns a new, empty Queue. Close it to stop the owning goroutine.
+func NewQueue[T any]() *Queue[T] {
+	return &Queue[T]{NewOf([]T(nil))}
+}
+
+// Close stops the owning goroutine. See Of.Close.
+func (q *Queue[T]) Close() {
+	q.o.Close()
+}
+
+// Push appends v to the queue.
+func (q *Queue[T]) Push(v T) {
+	q.o.Do(func(s []T) []T {
+		return append(s, v)
+	})
+}
+
+// TryPop removes and returns the first element of q, if it is not empty.
+func (q *Queue[T]) TryPop() (v T, ok bool) {
+	q.o.Do(func(s []T) []T {
+		if len(s) == 0 {
+			q.o.unchanged = true
+			return s
+		}
+		var zero T
+		v, ok, s[0] = s[0], true, zero
+		return s[1:]
+	})
+	return v, ok
+}
+
+// Pop removes and returns the first element of q. If q is empty, it blocks
+// until an element is pushed. It returns ErrClosed, if q is closed, and
+// ctx.Err(), if ctx is cancelled first.
+func (q *Queue[T]) Pop(ctx context.Context) (T, error) {
+	for {
+		if v, ok := q.TryPop(); ok {
+			return v, nil
+		}
+		_, err := q.o.WaitForContext(ctx, func(s []T) bool {
+			return len(s) > 0
+		})
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+}
+
+// Len returns the number of elements in q.
+func (q *Queue[T]) Len() (n int) {
+	q.o.read(func(s []T) {
+		n = len(s)
+	})
+	return n
+}
+
+// Snapshot returns a copy of the elements of q, taken atomically.
+func (q *Queue[T]) Snapshot() []T {
+	var c []T
+	q.o.read(func(s []T) {
+		c = append([]T(nil), s...)
+	})
+	return c
+}
+
+// Counter is an integer counter owned by a separate goroutine.
+type Counter struct {
+	o *Of[int64]
+}
+
+// NewCounter returns a new Counter, initialized to 0. Close it to stop the
+// owning goroutine.
+func NewCounter() *Counter {
+	return &Counter{NewOf(int64(0))}
+}
+
+// Close stops the owning goroutine. See Of.Close.
+func (c *Counter) Close() {
+	c.o.Close()
+}
+
+// Add atomically adds delta to c and returns the new value.
+func (c *Counter) Add(delta int64) (n int64) {
+	c.o.Do(func(v int64) int64 {
+		n = v + delta
+		return n
+	})
+	return n
+}
+
+// Snapshot returns the current value of c.
+func (c *Counter) Snapshot() int64 {
+	return c.o.Get()
+}
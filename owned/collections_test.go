@@ -0,0 +1,182 @@
+package owned
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func ExampleMap() {
+	m := NewMap[string, int]()
+	defer m.Close()
+
+	m.Store("foo", 42)
+	v, loaded := m.LoadOrStore("foo", 23)
+	fmt.Println(v, loaded)
+	v, loaded = m.LoadOrStore("bar", 23)
+	fmt.Println(v, loaded)
+
+	m.Delete("foo")
+	fmt.Println(m.Snapshot())
+
+	// Output:
+	// 42 true
+	// 23 false
+	// map[bar:23]
+}
+
+func ExampleQueue() {
+	q := NewQueue[string]()
+	defer q.Close()
+
+	go func() {
+		q.Push("foo")
+		q.Push("bar")
+	}()
+
+	for i := 0; i < 2; i++ {
+		v, _ := q.Pop(context.Background())
+		fmt.Println(v)
+	}
+
+	// Output:
+	// foo
+	// bar
+}
+
+func TestMapConcurrent(t *testing.T) {
+	m := NewMap[int, int]()
+	defer m.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.Store(i*100+j, j)
+				m.Load(j)
+				m.Range(func(k, v int) bool {
+					return k < 50
+				})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := m.Len(); n != 1000 {
+		t.Errorf("m.Len() == %d, expected 1000", n)
+	}
+}
+
+func TestQueueConcurrent(t *testing.T) {
+	q := NewQueue[int]()
+	defer q.Close()
+
+	var (
+		wg  sync.WaitGroup
+		mtx sync.Mutex
+		got []int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				q.Push(i*100 + j)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				v, err := q.Pop(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mtx.Lock()
+				got = append(got, v)
+				mtx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Ints(got)
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("got[%d] == %d, expected %d", i, v, i)
+		}
+	}
+	if len(got) != 1000 {
+		t.Errorf("Popped %d elements, expected 1000", len(got))
+	}
+}
+
+func TestQueuePopCancel(t *testing.T) {
+	q := NewQueue[int]()
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Pop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Pop on empty queue returned %v, expected %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestCounterConcurrent(t *testing.T) {
+	c := NewCounter()
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := c.Snapshot(); n != 1000 {
+		t.Errorf("c.Snapshot() == %d, expected 1000", n)
+	}
+}
+
+func TestReadsDontNotify(t *testing.T) {
+	m := NewMap[string, int]()
+	defer m.Close()
+	q := NewQueue[int]()
+	defer q.Close()
+	mc, qc := m.o.Watch(), q.o.Watch()
+
+	m.Store("foo", 1)
+	<-mc
+	m.Load("foo")
+	m.Len()
+	m.Snapshot()
+	m.LoadOrStore("foo", 2)
+	m.Delete("bar")
+	q.Len()
+	q.Snapshot()
+	q.TryPop()
+	m.o.Get()
+	q.o.Get()
+	select {
+	case v := <-mc:
+		t.Errorf("Reading the map notified watchers with %v", v)
+	case v := <-qc:
+		t.Errorf("Reading the queue notified watchers with %v", v)
+	default:
+	}
+
+	m.Delete("foo")
+	if v := <-mc; len(v) != 0 {
+		t.Errorf("Watcher got %v after Delete, want empty map", v)
+	}
+}
@@ -0,0 +1,149 @@
+package owned
+
+import (
+	"bytes"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultSlowFilter is the SlowFilter threshold used, if the package is built
+// with the owned_debug tag and none is set.
+const defaultSlowFilter = time.Second
+
+// DeadlockError is panicked with by operations on an Of in debug mode, if
+// they would deadlock. That is the case, if they are called from within a
+// filter on the same value, or from within a transaction holding it.
+type DeadlockError struct {
+	// Stack is the stack trace of the offending call.
+	Stack []byte
+}
+
+func (e *DeadlockError) Error() string {
+	return "owned: re-entrant operation would deadlock"
+}
+
+// debugState is the state of an Of in debug mode.
+type debugState struct {
+	enabled bool
+	slow    time.Duration
+	owner   int64
+	holder  int64
+}
+
+func newDebugState(opts Options) debugState {
+	d := debugState{
+		enabled: opts.Debug || debugTag,
+		slow:    opts.SlowFilter,
+	}
+	if d.slow == 0 && debugTag {
+		d.slow = defaultSlowFilter
+	}
+	return d
+}
+
+// checkReentrant panics with a *DeadlockError, if called from the owning
+// goroutine or a transaction holding the value.
+func (d *debugState) checkReentrant() {
+	if !d.enabled {
+		return
+	}
+	id := goid()
+	if id == atomic.LoadInt64(&d.owner) || id == atomic.LoadInt64(&d.holder) {
+		panic(&DeadlockError{Stack: debug.Stack()})
+	}
+}
+
+// debugValues maps every Value in debug mode to its debugState, as the
+// methods of Value only have the channel. numDebugValues is its size, so the
+// lookup can be skipped if no Value is in debug mode.
+var (
+	debugValues    sync.Map
+	numDebugValues int32
+)
+
+// checkReentrant is like debugState.checkReentrant for the Of behind ch.
+func (ch Value) checkReentrant() {
+	if atomic.LoadInt32(&numDebugValues) == 0 {
+		return
+	}
+	if d, ok := debugValues.Load(ch); ok {
+		d.(*debugState).checkReentrant()
+	}
+}
+
+// setOwner records the calling goroutine as the owning goroutine.
+func (d *debugState) setOwner() {
+	if d.enabled {
+		atomic.StoreInt64(&d.owner, goid())
+	}
+}
+
+// setHolder records the calling goroutine as holding the value in a
+// transaction.
+func (d *debugState) setHolder(held bool) {
+	if !d.enabled {
+		return
+	}
+	var id int64
+	if held {
+		id = goid()
+	}
+	atomic.StoreInt64(&d.holder, id)
+}
+
+// watchSlow reports the filter running in the owning goroutine, if it takes
+// longer than the threshold. The returned function must be called after the
+// filter returned.
+func (d *debugState) watchSlow(report func(time.Duration, []byte)) (stop func() bool) {
+	if !d.enabled || d.slow <= 0 {
+		return func() bool { return false }
+	}
+	if report == nil {
+		report = func(d time.Duration, stack []byte) {
+			log.Printf("owned: filter running for more than %v:\n%s", d, stack)
+		}
+	}
+	owner := atomic.LoadInt64(&d.owner)
+	t := time.AfterFunc(d.slow, func() {
+		report(d.slow, goroutineStack(owner))
+	})
+	return t.Stop
+}
+
+// goid returns the id of the calling goroutine. It is slow and only meant for
+// debugging.
+func goid() int64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i >= 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseInt(string(buf), 10, 64)
+	return id
+}
+
+// goroutineStack returns the stack trace of the goroutine with the given id.
+func goroutineStack(id int64) []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	prefix := []byte("goroutine " + strconv.FormatInt(id, 10) + " ")
+	for _, s := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.HasPrefix(s, prefix) {
+			return s
+		}
+	}
+	return nil
+}
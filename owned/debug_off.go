@@ -0,0 +1,6 @@
+//go:build !owned_debug
+
+package owned
+
+// debugTag enables debug mode for all values.
+const debugTag = false
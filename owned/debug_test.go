@@ -0,0 +1,109 @@
+package owned
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDebugReentrant(t *testing.T) {
+	o := NewOfWithOptions(42, Options{Debug: true})
+	defer o.Close()
+
+	defer func() {
+		pe, ok := recover().(*PanicError)
+		if !ok {
+			t.Fatalf("Re-entrant Get did not panic with a *PanicError")
+		}
+		if _, ok := pe.Value.(*DeadlockError); !ok {
+			t.Fatalf("Re-entrant Get panicked with %v, expected a *DeadlockError", pe.Value)
+		}
+		if o.Get() != 42 {
+			t.Errorf("Held value changed by panicking filter")
+		}
+	}()
+	o.Do(func(v int) int {
+		return o.Get() + 1
+	})
+}
+
+func TestDebugReentrantClose(t *testing.T) {
+	o := NewOfWithOptions(42, Options{Debug: true})
+	defer o.Close()
+
+	err := o.DoContext(context.Background(), func(v int) int {
+		o.Close()
+		return v + 1
+	})
+	pe, ok := err.(*PanicError)
+	if !ok {
+		t.Fatalf("Re-entrant Close returned %v, expected a *PanicError", err)
+	}
+	if _, ok := pe.Value.(*DeadlockError); !ok {
+		t.Fatalf("Re-entrant Close panicked with %v, expected a *DeadlockError", pe.Value)
+	}
+	if o.Get() != 42 {
+		t.Errorf("Held value changed by panicking filter")
+	}
+}
+
+func TestDebugValueReentrant(t *testing.T) {
+	ch := newValue(42, Options{Debug: true})
+	defer close(ch)
+
+	panics := make(chan interface{}, 1)
+	ch <- func(v interface{}) (ret interface{}) {
+		ret = v
+		defer func() { panics <- recover() }()
+		return ch.Get()
+	}
+	if p, ok := (<-panics).(*DeadlockError); !ok {
+		t.Fatalf("Re-entrant Get panicked with %v, expected a *DeadlockError", p)
+	}
+	if ch.Get() != 42 {
+		t.Errorf("Held value changed by re-entrant Get")
+	}
+}
+
+func TestDebugTransaction(t *testing.T) {
+	o := NewOfWithOptions(42, Options{Debug: true})
+	defer o.Close()
+
+	defer func() {
+		if _, ok := recover().(*DeadlockError); !ok {
+			t.Fatalf("Get in transaction did not panic with a *DeadlockError")
+		}
+		// The value must have been released.
+		o.Get()
+	}()
+	Atomically(func(tx *Tx) error {
+		o.Get()
+		return nil
+	}, o)
+}
+
+func TestDebugSlowFilter(t *testing.T) {
+	reports := make(chan []byte, 1)
+	o := NewOfWithOptions(42, Options{
+		Debug:      true,
+		SlowFilter: time.Millisecond,
+		OnSlowFilter: func(d time.Duration, stack []byte) {
+			reports <- stack
+		},
+	})
+	defer o.Close()
+
+	o.Do(func(v int) int {
+		time.Sleep(50 * time.Millisecond)
+		return v
+	})
+	select {
+	case stack := <-reports:
+		if !bytes.Contains(stack, []byte("TestDebugSlowFilter")) {
+			t.Errorf("Stack of slow filter does not contain the filter:\n%s", stack)
+		}
+	default:
+		t.Errorf("Slow filter not reported")
+	}
+}
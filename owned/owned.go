@@ -7,6 +7,9 @@
 // the examples (and the code of this package) of how to use this for common
 // operations.
 //
+// Of is the type-safe variant of this container. Value is the original,
+// untyped API, which is kept as a thin adapter over Of[interface{}].
+//
 // The value can be anything, but if you use a pointer, you should never retain
 // it outside of the filter-function. Otherwise races are still possible. This
 // means, in particular, that you shouldn't use the Get method on
@@ -15,34 +18,539 @@
 // The code heavily uses channels and closures and is thus a bit
 // allocation-heavy and probably significantly slower than relying on a mutex.
 // It is mainly meant as an example of how communication can elegantly express
-// shared-memory patterns.
+// shared-memory patterns. The Get, Set and CAS methods of Of don't allocate
+// and batch operations under contention, which makes them somewhat faster
+// than the original design, but every operation is still a round trip to the
+// owning goroutine, so they are orders of magnitude slower than a mutex or
+// atomic.Value. See the benchmarks.
 package owned
 
-// Value represents a value owned by a separate goroutine.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by operations on a closed Of.
+var ErrClosed = errors.New("owned: value is closed")
+
+// PanicError is returned (or panicked with) by operations whose filter
+// panicked. The held value is left unchanged in that case.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the owning goroutine at the time of the
+	// panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("owned: filter panicked: %v", e.Value)
+}
+
+// Options contain optional configuration for an Of.
+type Options struct {
+	// OnPanic, if not nil, is called in the owning goroutine with every
+	// panic recovered from a filter, e.g. for logging.
+	OnPanic func(*PanicError)
+
+	// Debug enables detection of operations that would deadlock, because
+	// they are called from within a filter on the same value (or from within
+	// a transaction holding it). They panic with a *DeadlockError instead.
+	// Debug mode is slow. It is enabled for all values, if the package is
+	// built with the owned_debug tag.
+	Debug bool
+
+	// SlowFilter, if positive, is the duration after which a running filter
+	// is reported in debug mode. If the package is built with the
+	// owned_debug tag, it defaults to one second.
+	SlowFilter time.Duration
+
+	// OnSlowFilter, if not nil, is called with the stack trace of the
+	// owning goroutine, if a filter runs longer than SlowFilter. By default,
+	// slow filters are logged.
+	OnSlowFilter func(d time.Duration, stack []byte)
+
+	// Persist, if not nil, configures writing snapshots of the value to a
+	// file. Use Restore to initialize a value from a snapshot.
+	Persist *Persistence
+}
+
+// mailboxSize is the number of operations that can be queued for an Of
+// without blocking the senders. The owning goroutine applies all queued
+// operations in one wakeup.
+const mailboxSize = 64
+
+type opKind uint8
+
+const (
+	opDo opKind = iota
+	opGet
+	opSet
+	opCAS
+)
+
+// op is an operation sent to the owning goroutine. Get, Set and CAS are
+// represented without closures, so they don't allocate.
+type op[T any] struct {
+	kind opKind
+	f    func(T) T
+	a, b T
+	// eq, if not nil, compares the held value for opCAS.
+	eq equaler[T]
+	c  *call[T]
+}
+
+// call tracks an operation waiting for its result. Calls are pooled, unless
+// they are cancelled.
+type call[T any] struct {
+	res   chan result[T]
+	state int32
+}
+
+// States of a call. Only a queued call can be started or cancelled.
+const (
+	callQueued int32 = iota
+	callStarted
+	callCancelled
+)
+
+type result[T any] struct {
+	v   T
+	ok  bool
+	err *PanicError
+}
+
+// Of represents a value of type T owned by a separate goroutine.
+type Of[T any] struct {
+	ops     chan op[T]
+	filters chan func(T) T
+	done    chan struct{}
+	stopped chan struct{}
+	// sending counts calls of enqueue in progress.
+	sending int32
+	once    sync.Once
+	calls   sync.Pool
+	opts    Options
+	id      uint64
+	debug   debugState
+	persist *persister
+
+	// Only accessed by the owning goroutine.
+	unchanged bool
+	watchers  map[<-chan T]chan T
+	waiters   map[*waiter[T]]bool
+}
+
+// NewOf returns an owned value, initialized to v. Close it to stop the owning
+// goroutine.
+func NewOf[T any](v T) *Of[T] {
+	return NewOfWithOptions(v, Options{})
+}
+
+// NewOfWithOptions is like NewOf, but configures the value with opts.
+func NewOfWithOptions[T any](v T, opts Options) *Of[T] {
+	o := newOf[T](opts)
+	go o.loop(v)
+	return o
+}
+
+// newOf returns an Of configured with opts, without an owning goroutine.
+func newOf[T any](opts Options) *Of[T] {
+	o := &Of[T]{
+		ops:     make(chan op[T], mailboxSize),
+		filters: make(chan func(T) T),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		opts:    opts,
+		id:      atomic.AddUint64(&lastID, 1),
+		debug:   newDebugState(opts),
+		persist: newPersister(opts.Persist),
+	}
+	o.calls.New = func() interface{} {
+		return &call[T]{res: make(chan result[T], 1)}
+	}
+	return o
+}
+
+// loop applies all operations to v, until o (or the filter channel) is
+// closed.
+func (o *Of[T]) loop(v T) {
+	o.debug.setOwner()
+	defer close(o.stopped)
+	defer o.stopWatchers()
+	defer func() { o.persist.close(v) }()
+	for {
+		select {
+		case op := <-o.ops:
+			v = o.do(op, v)
+			v = o.drain(v)
+			// Give callers a chance to queue more operations, before
+			// blocking in the select again, which is expensive.
+			runtime.Gosched()
+			v = o.drain(v)
+		case <-o.persist.tick():
+			o.persist.due(v)
+		case r := <-o.persist.written():
+			o.persist.result(r)
+		case f, ok := <-o.filters:
+			if !ok {
+				return
+			}
+			v = o.do(op[T]{kind: opDo, f: f}, v)
+		case <-o.done:
+			// Drain operations that are pending or being enqueued. After
+			// done is closed, no new enqueue can succeed.
+			for {
+				v = o.drain(v)
+				select {
+				case f, ok := <-o.filters:
+					if !ok {
+						return
+					}
+					v = o.do(op[T]{kind: opDo, f: f}, v)
+					continue
+				default:
+				}
+				if atomic.LoadInt32(&o.sending) == 0 {
+					v = o.drain(v)
+					return
+				}
+				runtime.Gosched()
+			}
+		}
+	}
+}
+
+// drain applies all queued operations to v, without blocking.
+func (o *Of[T]) drain(v T) T {
+	for {
+		select {
+		case op := <-o.ops:
+			v = o.do(op, v)
+		default:
+			return v
+		}
+	}
+}
+
+// do applies op to v, notifies watchers, unless op left the value unchanged,
+// and sends the result. Cancelled operations are skipped.
+func (o *Of[T]) do(op op[T], v T) T {
+	if op.c != nil && !atomic.CompareAndSwapInt32(&op.c.state, callQueued, callStarted) {
+		return v
+	}
+	var r result[T]
+	o.unchanged = false
+	stop := o.debug.watchSlow(o.opts.OnSlowFilter)
+	switch op.kind {
+	case opGet:
+		r.v = v
+		o.unchanged = true
+	case opSet:
+		r.v, v = v, op.a
+	case opCAS:
+		if r.ok, r.err = o.equal(op.eq, v, op.a); r.ok {
+			v = op.b
+		} else {
+			o.unchanged = true
+		}
+	case opDo:
+		v, r.err = o.run(op.f, v)
+	}
+	stop()
+	if !o.unchanged {
+		o.notify(v)
+		if o.persist != nil {
+			// Checked here, to avoid converting v to an interface.
+			o.persist.changed(v)
+		}
+	}
+	if op.c != nil {
+		op.c.res <- r
+	}
+	return v
+}
+
+// run returns f(v). If f panics, it returns v and the recovered panic.
+func (o *Of[T]) run(f func(T) T, v T) (ret T, err *PanicError) {
+	defer o.recover(&err)
+	ret = v
+	return f(v), nil
+}
+
+// equal returns whether a == b. If they are not comparable, it returns the
+// recovered panic.
+func (o *Of[T]) equal(e equaler[T], a, b T) (eq bool, err *PanicError) {
+	defer o.recover(&err)
+	if e != nil {
+		return e.equal(a, b), nil
+	}
+	return interface{}(a) == interface{}(b), nil
+}
+
+// recover recovers a panic into *err and passes it to the OnPanic hook. It
+// must be deferred directly.
+func (o *Of[T]) recover(err **PanicError) {
+	if r := recover(); r != nil {
+		*err = &PanicError{Value: r, Stack: debug.Stack()}
+		o.unchanged = true
+		if o.opts.OnPanic != nil {
+			o.opts.OnPanic(*err)
+		}
+	}
+}
+
+// Close stops the owning goroutine, after applying all pending operations.
+// Afterwards, all operations fail with ErrClosed. Close can be called
+// multiple times.
+func (o *Of[T]) Close() {
+	o.debug.checkReentrant()
+	o.once.Do(func() { close(o.done) })
+	<-o.stopped
+}
+
+// exec sends op to the owning goroutine and waits for its result. It fails if
+// o is closed or ctx is cancelled before op is started.
+func (o *Of[T]) exec(ctx context.Context, op op[T]) (r result[T], err error) {
+	o.debug.checkReentrant()
+	c := o.calls.Get().(*call[T])
+	c.state = callQueued
+	op.c = c
+	if err := o.enqueue(ctx, op); err != nil {
+		o.calls.Put(c)
+		return r, err
+	}
+
+	// A queued op is always applied (or skipped, if cancelled), so without a
+	// cancellable ctx, we can wait for the result without a select.
+	if done := ctx.Done(); done == nil {
+		r = <-c.res
+	} else {
+		select {
+		case r = <-c.res:
+		case <-done:
+			if atomic.CompareAndSwapInt32(&c.state, callQueued, callCancelled) {
+				// The owning goroutine skips op. c is not reused, as op
+				// still refers to it.
+				return r, ctx.Err()
+			}
+			// op was started already, so we have to wait for it.
+			r = <-c.res
+		}
+	}
+	o.calls.Put(c)
+	return r, nil
+}
+
+// send is like exec for a filter, but does not wait for it to be applied.
+func (o *Of[T]) send(ctx context.Context, f func(T) T) error {
+	o.debug.checkReentrant()
+	return o.enqueue(ctx, op[T]{kind: opDo, f: f})
+}
+
+// enqueue puts op into the mailbox. It fails if o is closed or ctx is
+// cancelled first. If it succeeds, op is applied before the owning goroutine
+// stops, as it drains the mailbox until no enqueue is in progress.
+func (o *Of[T]) enqueue(ctx context.Context, op op[T]) error {
+	atomic.AddInt32(&o.sending, 1)
+	defer atomic.AddInt32(&o.sending, -1)
+	select {
+	case <-o.done:
+		return ErrClosed
+	default:
+	}
+	// Try without blocking first, which is much cheaper than a select.
+	select {
+	case o.ops <- op:
+		return nil
+	default:
+	}
+	select {
+	case o.ops <- op:
+		return nil
+	case <-o.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// filter is like exec for a filter and returns its panic, if any.
+func (o *Of[T]) filter(ctx context.Context, f func(T) T) error {
+	r, err := o.exec(ctx, op[T]{kind: opDo, f: f})
+	if err != nil {
+		return err
+	}
+	if r.err != nil {
+		return r.err
+	}
+	return nil
+}
+
+// Do atomically replaces the held value by f applied to it. It returns after
+// f returned. If o is closed, f is not called. If f panics, the held value is
+// left unchanged and Do panics with a *PanicError.
+//
+// As values of type T can't be compared in general, every call of f counts as
+// a change, even if f returns the value unchanged: It notifies watchers and
+// counts towards Persistence.Every. Use Get to only read the value.
+func (o *Of[T]) Do(f func(T) T) {
+	if err := o.DoContext(context.Background(), f); err != nil && err != ErrClosed {
+		panic(err)
+	}
+}
+
+// read calls f with the held value. Unlike Do, it does not count as a change,
+// so it neither notifies watchers nor persists the value.
+func (o *Of[T]) read(f func(T)) {
+	o.Do(func(v T) T {
+		f(v)
+		o.unchanged = true
+		return v
+	})
+}
+
+// DoContext is like Do, but gives up if ctx is cancelled before f is started.
+// It returns ErrClosed, if o is closed, ctx.Err(), if ctx is cancelled, and a
+// *PanicError, if f panics.
+func (o *Of[T]) DoContext(ctx context.Context, f func(T) T) error {
+	return o.filter(ctx, f)
+}
+
+// Get is a shorthand to atomically load the current value. If T is a pointer
+// type, you shouldn't use this method (as only the pointer is synchronized,
+// not the value pointed to). If o is closed, Get returns the zero value.
+func (o *Of[T]) Get() T {
+	v, _ := o.GetContext(context.Background())
+	return v
+}
+
+// GetContext is like Get, but gives up if ctx is cancelled first. It returns
+// ErrClosed, if o is closed, and ctx.Err(), if ctx is cancelled.
+func (o *Of[T]) GetContext(ctx context.Context) (T, error) {
+	r, err := o.exec(ctx, op[T]{kind: opGet})
+	return r.v, err
+}
+
+// Set is a shorthand to atomically set the current value. The value before the
+// change will be returned. If T is a pointer type, you shouldn't use the
+// return value (as only the pointer is synchronized, not the value pointed
+// to). If o is closed, Set does nothing and returns the zero value.
+func (o *Of[T]) Set(to T) (old T) {
+	old, _ = o.SetContext(context.Background(), to)
+	return old
+}
+
+// SetContext is like Set, but gives up if ctx is cancelled first. It returns
+// ErrClosed, if o is closed, and ctx.Err(), if ctx is cancelled.
+func (o *Of[T]) SetContext(ctx context.Context, to T) (old T, err error) {
+	r, err := o.exec(ctx, op[T]{kind: opSet, a: to})
+	return r.v, err
+}
+
+// CAS is a shorthand to atomically compare-and-swap the current value. It will
+// return, whether the swap took place. Values are compared with ==, so CAS
+// panics (with a *PanicError) if the held value is not comparable. If o is
+// closed, CAS returns false.
+//
+// Prefer the CAS function, which only accepts comparable types.
+func (o *Of[T]) CAS(cmp, set T) bool {
+	return o.cas(cmp, set, nil)
+}
+
+// CAS atomically compare-and-swaps the value held by o, like the CAS method,
+// but can only be used with comparable types. Like ==, it still panics if T is
+// an interface type and the held value is not comparable.
+func CAS[T comparable](o *Of[T], cmp, set T) bool {
+	return o.cas(cmp, set, comparer[T]{})
+}
+
+// An equaler compares values of type T, for CAS.
+type equaler[T any] interface {
+	equal(a, b T) bool
+}
+
+// comparer is an equaler. It is an empty struct, so it can be stored in an
+// equaler without allocating.
+type comparer[T comparable] struct{}
+
+func (comparer[T]) equal(a, b T) bool {
+	return a == b
+}
+
+func (o *Of[T]) cas(cmp, set T, eq equaler[T]) bool {
+	r, err := o.exec(context.Background(), op[T]{kind: opCAS, a: cmp, b: set, eq: eq})
+	if err != nil {
+		return false
+	}
+	if r.err != nil {
+		panic(r.err)
+	}
+	return r.ok
+}
+
+// Value represents a value owned by a separate goroutine. The owning
+// goroutine stops when the channel is closed; afterwards, all operations
+// panic. Use Of, to get context-aware operations and a safe Close.
+//
+// If a filter sent to a Value panics, the held value is left unchanged. If the
+// package is built with the owned_debug tag, Get, Set and CAS panic with a
+// *DeadlockError when called from within a filter on the same Value.
 type Value chan<- func(interface{}) interface{}
 
-// New returns an owned value, initialized to v.
+// New returns an owned value, initialized to v. The returned channel passes
+// filters to an Of[interface{}].
 func New(v interface{}) Value {
-	ch := make(chan func(interface{}) interface{})
-	go func() {
-		for {
-			for f := range ch {
-				v = f(v)
-			}
-			return
+	return newValue(v, Options{})
+}
+
+func newValue(v interface{}, opts Options) Value {
+	o := newOf[interface{}](opts)
+	if o.debug.enabled {
+		debugValues.Store(Value(o.filters), &o.debug)
+		atomic.AddInt32(&numDebugValues, 1)
+	}
+	go loopValue(o, v)
+	return o.filters
+}
+
+// loopValue is the loop of an Of used as a Value. Only its filter channel is
+// reachable, so the owning goroutine only has to receive from that, which is
+// cheaper than the select in loop.
+func loopValue(o *Of[interface{}], v interface{}) {
+	o.debug.setOwner()
+	defer close(o.stopped)
+	if o.debug.enabled {
+		defer func() {
+			debugValues.Delete(Value(o.filters))
+			atomic.AddInt32(&numDebugValues, -1)
+		}()
+	}
+	for f := range o.filters {
+		if o.debug.enabled {
+			v = o.do(op[interface{}]{kind: opDo, f: f}, v)
+			continue
 		}
-	}()
-	return ch
+		// A Value has no watchers or persistence, so there is nothing to
+		// do but to apply f.
+		v, _ = o.run(f, v)
+	}
 }
 
 // Get is a shorthand to atomically load the current value. If the held value
 // is of a pointer type, you shouldn't use this method (as only the pointer is
 // synchronized, not the value pointed to).
 func (ch Value) Get() interface{} {
+	ch.checkReentrant()
 	ret := make(chan interface{})
 	ch <- func(v interface{}) interface{} {
 		ret <- v
-		close(ret)
 		return v
 	}
 	return <-ret
@@ -53,26 +561,38 @@ func (ch Value) Get() interface{} {
 // shouldn't use the return value (as only the pointer is synchronized, not the
 // value pointed to).
 func (ch Value) Set(to interface{}) (old interface{}) {
+	ch.checkReentrant()
 	ret := make(chan interface{})
 	ch <- func(v interface{}) interface{} {
 		ret <- v
-		close(ret)
 		return to
 	}
 	return <-ret
 }
 
 // CAS is a shorthand to atomically compare-and-swap the current value. It will
-// return, whether the swap took place.
+// return, whether the swap took place. Values are compared with ==, so CAS
+// panics (with a *PanicError) if the held value is not comparable.
 func (ch Value) CAS(cmp, set interface{}) bool {
-	ret := make(chan bool)
-	ch <- func(v interface{}) interface{} {
-		if v == cmp {
-			ret <- true
+	ch.checkReentrant()
+	ret := make(chan result[interface{}])
+	ch <- func(v interface{}) (next interface{}) {
+		var r result[interface{}]
+		// Recovered here, as the owner would leave ret empty.
+		defer func() {
+			if p := recover(); p != nil {
+				r.err, next = &PanicError{Value: p, Stack: debug.Stack()}, v
+			}
+			ret <- r
+		}()
+		if r.ok = v == cmp; r.ok {
 			return set
 		}
-		ret <- false
 		return v
 	}
-	return <-ret
+	r := <-ret
+	if r.err != nil {
+		panic(r.err)
+	}
+	return r.ok
 }
@@ -1,6 +1,12 @@
 package owned
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
 
 func Example() {
 	ch := New(nil)
@@ -48,3 +54,211 @@ func Example() {
 	// Swapped
 	// Didn't swap
 }
+
+func ExampleOf() {
+	o := NewOf(42)
+
+	// Set returns the old value, no type assertions needed.
+	old := o.Set(23)
+	fmt.Println("Old value:", old)
+
+	// Do applies a filter atomically.
+	o.Do(func(v int) int {
+		return v * 2
+	})
+	fmt.Println("Current value:", o.Get())
+
+	// CAS only compiles with comparable types.
+	if CAS(o, 46, 1337) {
+		fmt.Println("Swapped to", o.Get())
+	}
+
+	// Output:
+	// Old value: 42
+	// Current value: 46
+	// Swapped to 1337
+}
+
+func ExampleOf_Close() {
+	o := NewOf("foo")
+	o.Close()
+
+	_, err := o.GetContext(context.Background())
+	fmt.Println(err)
+
+	// Output:
+	// owned: value is closed
+}
+
+func ExampleOptions() {
+	o := NewOfWithOptions(42, Options{
+		OnPanic: func(err *PanicError) {
+			fmt.Println("Recovered:", err.Value)
+		},
+	})
+
+	err := o.DoContext(context.Background(), func(v int) int {
+		panic("oops")
+	})
+	fmt.Println(err)
+	fmt.Println("Current value:", o.Get())
+
+	// Output:
+	// Recovered: oops
+	// owned: filter panicked: oops
+	// Current value: 42
+}
+
+func ExampleOf_Watch() {
+	o := NewOf(0)
+	c := o.Watch()
+
+	o.Set(1)
+	o.Set(2)
+	o.Get()
+	// Values are coalesced, so only the latest one is read.
+	fmt.Println("Changed to", <-c)
+
+	o.Unwatch(c)
+	_, ok := <-c
+	fmt.Println(ok)
+
+	// Output:
+	// Changed to 2
+	// false
+}
+
+func ExampleOf_WaitFor() {
+	o := NewOf(0)
+	go func() {
+		for i := 0; i < 10; i++ {
+			o.Do(func(v int) int { return v + 1 })
+		}
+	}()
+
+	fmt.Println(o.WaitFor(func(v int) bool { return v >= 5 }))
+
+	// Output:
+	// 5
+}
+
+func ExampleAtomically() {
+	from, to := NewOf([]string{"a", "b"}), NewOf([]string(nil))
+
+	move := func(tx *Tx) error {
+		q := Load(tx, from)
+		if len(q) == 0 {
+			return errors.New("empty")
+		}
+		Store(tx, from, q[1:])
+		Store(tx, to, append(Load(tx, to), q[0]))
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		if err := Atomically(move, from, to); err != nil {
+			fmt.Println("Error:", err)
+		}
+	}
+	fmt.Println(from.Get(), to.Get())
+
+	// Output:
+	// Error: empty
+	// [] [a b]
+}
+
+func TestContextBusy(t *testing.T) {
+	o := NewOf(0)
+	defer o.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	go o.Do(func(v int) int {
+		close(started)
+		<-release
+		return v
+	})
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := o.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("GetContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("GetContext() returned after %v", d)
+	}
+	if _, err := o.SetContext(ctx, 1); err != context.DeadlineExceeded {
+		t.Errorf("SetContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := o.DoContext(ctx, func(int) int { t.Error("cancelled filter called"); return 2 }); err != context.DeadlineExceeded {
+		t.Errorf("DoContext() = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	release <- struct{}{}
+	if v := o.Get(); v != 0 {
+		t.Errorf("Get() = %d after cancelled operations, want 0", v)
+	}
+}
+
+func TestCAS(t *testing.T) {
+	type point struct{ x, y int }
+	o := NewOf(point{1, 2})
+
+	if CAS(o, point{2, 1}, point{3, 4}) {
+		t.Error("CAS with wrong value swapped")
+	}
+	if !CAS(o, point{1, 2}, point{3, 4}) {
+		t.Error("CAS with current value did not swap")
+	}
+	if got, want := o.Get(), (point{3, 4}); got != want {
+		t.Errorf("Get() = %v after CAS, want %v", got, want)
+	}
+	o.Close()
+	if CAS(o, point{3, 4}, point{5, 6}) {
+		t.Error("CAS on closed value swapped")
+	}
+}
+
+func TestAtomicallyNilInterface(t *testing.T) {
+	e := NewOf[error](nil)
+	defer e.Close()
+	i := NewOf[interface{}](1)
+	defer i.Close()
+
+	err := Atomically(func(tx *Tx) error {
+		if err := Load(tx, e); err != nil {
+			t.Errorf("Load() = %v, want <nil>", err)
+		}
+		Store[interface{}](tx, i, nil)
+		return nil
+	}, e, i)
+	if err != nil {
+		t.Fatalf("Atomically() = %v", err)
+	}
+	if v := i.Get(); v != nil {
+		t.Errorf("Get() = %v after storing nil, want <nil>", v)
+	}
+}
+
+func TestValueCASNotComparable(t *testing.T) {
+	ch := New([]int{1})
+	defer close(ch)
+
+	done := make(chan interface{})
+	go func() {
+		defer func() { done <- recover() }()
+		ch.CAS([]int{1}, 2)
+	}()
+	select {
+	case r := <-done:
+		if _, ok := r.(*PanicError); !ok {
+			t.Errorf("CAS on a slice panicked with %v, want a *PanicError", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("CAS on a slice blocked")
+	}
+	if v := ch.Get().([]int); len(v) != 1 || v[0] != 1 {
+		t.Errorf("Get() = %v after failed CAS, want [1]", v)
+	}
+}
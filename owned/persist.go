@@ -0,0 +1,294 @@
+package owned
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Codec encodes and decodes held values for persistence.
+type Codec interface {
+	Encode(w io.Writer, v interface{}) error
+	// Decode decodes into v, which is a pointer to the held type.
+	Decode(r io.Reader, v interface{}) error
+}
+
+var (
+	// GobCodec is a Codec using encoding/gob.
+	GobCodec Codec = gobCodec{}
+	// JSONCodec is a Codec using encoding/json.
+	JSONCodec Codec = jsonCodec{}
+)
+
+type gobCodec struct{}
+
+func (gobCodec) Encode(w io.Writer, v interface{}) error {
+	return gob.NewEncoder(w).Encode(v)
+}
+
+func (gobCodec) Decode(r io.Reader, v interface{}) error {
+	return gob.NewDecoder(r).Decode(v)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// Persistence configures writing snapshots of the held value to a file.
+// Snapshots are encoded by the owning goroutine between operations (never
+// inside a filter) and written by a separate goroutine. Each snapshot is
+// written to a temporary file, which is synced and then renamed to Path, so a
+// crash never leaves a partially written snapshot behind. If writing fails,
+// the snapshot is retried with the next change or Interval. A final snapshot is
+// written when the value is closed, unless the current value was already
+// written.
+//
+// As snapshots are encoded by the owning goroutine, the held value must not
+// be modified outside of filters, even if it is a pointer.
+type Persistence struct {
+	// Path is the file snapshots are written to.
+	Path string
+
+	// Codec encodes the held value. It defaults to GobCodec.
+	Codec Codec
+
+	// Every, if positive, writes a snapshot after every Every changes of
+	// the value.
+	Every int
+
+	// Interval, if positive, writes a snapshot every Interval, if the value
+	// changed since the last one.
+	Interval time.Duration
+
+	// OnError, if not nil, is called with errors encoding or writing
+	// snapshots. By default, they are logged.
+	OnError func(error)
+}
+
+func (p *Persistence) codec() Codec {
+	if p.Codec == nil {
+		return GobCodec
+	}
+	return p.Codec
+}
+
+// ErrNoPersistence is returned by Restore, if Options.Persist is nil.
+var ErrNoPersistence = errors.New("owned: Restore without Options.Persist")
+
+// Restore returns an owned value, initialized from the snapshot at
+// opts.Persist.Path. If the file does not exist, it is initialized to v.
+func Restore[T any](v T, opts Options) (*Of[T], error) {
+	if opts.Persist == nil {
+		return nil, ErrNoPersistence
+	}
+	f, err := os.Open(opts.Persist.Path)
+	if os.IsNotExist(err) {
+		return NewOfWithOptions(v, opts), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var restored T
+	if err := opts.Persist.codec().Decode(f, &restored); err != nil {
+		return nil, err
+	}
+	return NewOfWithOptions(restored, opts), nil
+}
+
+// persister writes snapshots of an Of. All methods but writer are only called
+// by the owning goroutine.
+type persister struct {
+	cfg    Persistence
+	ticker *time.Ticker
+	// seq counts the changes of the value. tried is the seq of the last
+	// encoded snapshot and saved the one of the last written snapshot. A
+	// value is dirty until a snapshot of it was written.
+	seq, tried, saved uint64
+	pending           chan snapshot
+	results           chan writeResult
+}
+
+type snapshot struct {
+	b   []byte
+	seq uint64
+}
+
+type writeResult struct {
+	seq uint64
+	err error
+}
+
+func newPersister(cfg *Persistence) *persister {
+	if cfg == nil {
+		return nil
+	}
+	p := &persister{
+		cfg:     *cfg,
+		pending: make(chan snapshot, 1),
+		results: make(chan writeResult),
+	}
+	if cfg.Interval > 0 {
+		p.ticker = time.NewTicker(cfg.Interval)
+	}
+	go p.writer()
+	return p
+}
+
+// tick returns a channel, on which a value is sent when a snapshot is due.
+func (p *persister) tick() <-chan time.Time {
+	if p == nil || p.ticker == nil {
+		return nil
+	}
+	return p.ticker.C
+}
+
+// written returns a channel, on which the writer reports written snapshots.
+func (p *persister) written() <-chan writeResult {
+	if p == nil {
+		return nil
+	}
+	return p.results
+}
+
+// changed records a change of the held value to v.
+func (p *persister) changed(v interface{}) {
+	if p == nil {
+		return
+	}
+	p.seq++
+	if p.cfg.Every > 0 && p.seq-p.tried >= uint64(p.cfg.Every) {
+		p.snapshot(v)
+	}
+}
+
+// due writes a snapshot of v, if it changed since the last one (or the last
+// one failed).
+func (p *persister) due(v interface{}) {
+	if p != nil && p.seq > p.tried {
+		p.snapshot(v)
+	}
+}
+
+// snapshot encodes v and passes it to the writer.
+func (p *persister) snapshot(v interface{}) {
+	p.tried = p.seq
+
+	buf := new(bytes.Buffer)
+	if err := p.cfg.codec().Encode(buf, v); err != nil {
+		p.error(err)
+		return
+	}
+	// Only the latest snapshot needs to be written.
+	select {
+	case <-p.pending:
+	default:
+	}
+	p.pending <- snapshot{buf.Bytes(), p.seq}
+}
+
+// result records the result of writing a snapshot. If it failed, the value
+// stays dirty, so the snapshot is retried with the next change or tick.
+func (p *persister) result(r writeResult) {
+	if r.err != nil {
+		p.tried = p.saved
+		return
+	}
+	if r.seq > p.saved {
+		p.saved = r.seq
+	}
+}
+
+// close writes a final snapshot of v, unless it was already written, and
+// waits for it.
+func (p *persister) close(v interface{}) {
+	if p == nil {
+		return
+	}
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+	if p.seq > p.saved {
+		p.snapshot(v)
+	}
+	close(p.pending)
+	for r := range p.results {
+		p.result(r)
+	}
+}
+
+// writer writes all snapshots passed by the owning goroutine and reports the
+// results.
+func (p *persister) writer() {
+	defer close(p.results)
+	for s := range p.pending {
+		err := writeFile(p.cfg.Path, s.b)
+		if err != nil {
+			p.error(err)
+		}
+		p.results <- writeResult{s.seq, err}
+	}
+}
+
+func (p *persister) error(err error) {
+	if p.cfg.OnError != nil {
+		p.cfg.OnError(err)
+		return
+	}
+	log.Printf("owned: could not write snapshot: %v", err)
+}
+
+// createTemp creates the temporary files snapshots are written to. It is
+// replaced in tests.
+var createTemp = os.CreateTemp
+
+// writeFile atomically replaces the file at path with b.
+func writeFile(path string, b []byte) (err error) {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := createTemp(dir, "."+name+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	// Sync the directory, so the rename is durable.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,200 @@
+package owned
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPersistRestore(t *testing.T) {
+	for _, c := range []Codec{GobCodec, JSONCodec} {
+		opts := Options{Persist: &Persistence{
+			Path:  filepath.Join(t.TempDir(), "snapshot"),
+			Codec: c,
+			Every: 2,
+			OnError: func(err error) {
+				t.Error(err)
+			},
+		}}
+
+		o, err := Restore(map[string]int{"foo": 1}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(opts.Persist.Path); !os.IsNotExist(err) {
+			t.Errorf("Snapshot written before any change: %v", err)
+		}
+		o.Do(func(m map[string]int) map[string]int {
+			m["bar"] = 2
+			return m
+		})
+		o.Get()
+		o.Close()
+
+		o, err = Restore(map[string]int(nil), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]int{"foo": 1, "bar": 2}
+		if got := o.Get(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Restore(%T) == %v, expected %v", c, got, want)
+		}
+		o.Close()
+	}
+}
+
+func TestRestoreWithoutPersistence(t *testing.T) {
+	if _, err := Restore(42, Options{}); err != ErrNoPersistence {
+		t.Errorf("Restore without Persist returned %v, expected %v", err, ErrNoPersistence)
+	}
+}
+
+// readSnapshot returns the int stored at path, or -1 if it can not be read.
+func readSnapshot(path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		return -1
+	}
+	defer f.Close()
+	var v int
+	if err := GobCodec.Decode(f, &v); err != nil {
+		return -1
+	}
+	return v
+}
+
+// waitSnapshot waits for the snapshot at path to be want.
+func waitSnapshot(t *testing.T, path string, want int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		if readSnapshot(path) == want {
+			return
+		}
+	}
+	t.Fatalf("Snapshot is %d, expected %d", readSnapshot(path), want)
+}
+
+func TestPersistEvery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+	o := NewOfWithOptions(0, Options{Persist: &Persistence{
+		Path:    path,
+		Every:   2,
+		OnError: func(err error) { t.Error(err) },
+	}})
+	defer o.Close()
+
+	o.Set(1)
+	o.Set(2)
+	waitSnapshot(t, path, 2)
+	o.Set(3)
+	o.Get()
+	time.Sleep(20 * time.Millisecond)
+	if v := readSnapshot(path); v != 2 {
+		t.Errorf("Snapshot is %d after one more change, expected 2", v)
+	}
+	o.Set(4)
+	waitSnapshot(t, path, 4)
+}
+
+func TestPersistInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot")
+	o := NewOfWithOptions(0, Options{Persist: &Persistence{
+		Path:     path,
+		Interval: 5 * time.Millisecond,
+		OnError:  func(err error) { t.Error(err) },
+	}})
+	defer o.Close()
+
+	o.Set(1)
+	waitSnapshot(t, path, 1)
+	o.Set(2)
+	waitSnapshot(t, path, 2)
+}
+
+func TestPersistFailedWrite(t *testing.T) {
+	var fail int32
+	defer func(f func(string, string) (*os.File, error)) { createTemp = f }(createTemp)
+	createTemp = func(dir, pattern string) (*os.File, error) {
+		f, err := os.CreateTemp(dir, pattern)
+		if err == nil && atomic.LoadInt32(&fail) != 0 {
+			// Writing to the closed file fails.
+			f.Close()
+		}
+		return f, err
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot")
+	errs := make(chan error, 10)
+	o := NewOfWithOptions(0, Options{Persist: &Persistence{
+		Path:    path,
+		Every:   1,
+		OnError: func(err error) { errs <- err },
+	}})
+
+	o.Set(1)
+	waitSnapshot(t, path, 1)
+	atomic.StoreInt32(&fail, 1)
+	o.Set(2)
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("Failed write not reported")
+	}
+	if v := readSnapshot(path); v != 1 {
+		t.Errorf("Snapshot is %d after failed write, expected 1", v)
+	}
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(des) != 1 {
+		t.Errorf("Temporary file not removed after failed write: %d files", len(des))
+	}
+
+	// The value stays dirty, so Close writes it once writing works again.
+	atomic.StoreInt32(&fail, 0)
+	o.Close()
+	if v := readSnapshot(path); v != 2 {
+		t.Errorf("Snapshot is %d after Close, expected 2", v)
+	}
+}
+
+func TestPersistRetry(t *testing.T) {
+	fail := int32(1)
+	defer func(f func(string, string) (*os.File, error)) { createTemp = f }(createTemp)
+	createTemp = func(dir, pattern string) (*os.File, error) {
+		if atomic.LoadInt32(&fail) != 0 {
+			return nil, errors.New("injected failure")
+		}
+		return os.CreateTemp(dir, pattern)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot")
+	errs := make(chan error, 10)
+	o := NewOfWithOptions(0, Options{Persist: &Persistence{
+		Path:     path,
+		Interval: 5 * time.Millisecond,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	}})
+	defer o.Close()
+
+	o.Set(7)
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("Failed write not reported")
+	}
+	// The next tick retries, without another change.
+	atomic.StoreInt32(&fail, 0)
+	waitSnapshot(t, path, 7)
+}
@@ -0,0 +1,5 @@
+//go:build !race
+
+package owned
+
+const raceEnabled = false
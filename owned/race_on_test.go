@@ -0,0 +1,7 @@
+//go:build race
+
+package owned
+
+// raceEnabled is set if the race detector is enabled, which makes sync.Pool
+// drop items randomly.
+const raceEnabled = true
@@ -0,0 +1,135 @@
+package owned
+
+import (
+	"context"
+	"sort"
+)
+
+// lastID is the last id assigned to an Of. Ids define the global order in
+// which Atomically acquires values.
+var lastID uint64
+
+// Lockable is a value that can take part in a transaction. It is implemented
+// by *Of[T] and can't be implemented outside this package.
+type Lockable interface {
+	order() uint64
+	acquire() (txEntry, error)
+}
+
+// Tx is a transaction over several owned values, see Atomically.
+type Tx struct {
+	entries map[Lockable]txEntry
+}
+
+// txEntry is an acquired value. It is a *entry[T], which keeps the value
+// typed, so interface types (including nil values) survive Load and Store.
+type txEntry interface {
+	// release releases the value, applying the stored value if commit is
+	// true.
+	release(commit bool)
+}
+
+type entry[T any] struct {
+	v     T
+	dirty bool
+	rel   chan<- txRelease[T]
+	o     *Of[T]
+}
+
+func (e *entry[T]) release(commit bool) {
+	e.o.debug.setHolder(false)
+	e.rel <- txRelease[T]{e.v, commit && e.dirty}
+}
+
+// Load returns the value held by o in tx. It panics, if o is not part of tx.
+func Load[T any](tx *Tx, o *Of[T]) T {
+	return entryOf(tx, o).v
+}
+
+// Store sets the value held by o in tx. The change is only applied, if the
+// transaction succeeds. It panics, if o is not part of tx.
+func Store[T any](tx *Tx, o *Of[T], v T) {
+	e := entryOf(tx, o)
+	e.v, e.dirty = v, true
+}
+
+func entryOf[T any](tx *Tx, o *Of[T]) *entry[T] {
+	e, ok := tx.entries[o]
+	if !ok {
+		panic("owned: value is not part of the transaction")
+	}
+	return e.(*entry[T])
+}
+
+// Atomically runs f with exclusive access to all values. Changes made with
+// Store are applied atomically, if f returns nil, and discarded if it returns
+// an error or panics.
+//
+// The values are acquired in a global order, so concurrent transactions can't
+// deadlock each other. While f runs, all other operations on the values
+// block, so f must not use them directly, other than via Load and Store. If
+// any of the values is closed, Atomically returns ErrClosed without calling
+// f.
+func Atomically(f func(tx *Tx) error, values ...Lockable) (err error) {
+	values = append([]Lockable(nil), values...)
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].order() < values[j].order()
+	})
+
+	tx := &Tx{entries: make(map[Lockable]txEntry)}
+	commit := false
+	defer func() {
+		for _, e := range tx.entries {
+			e.release(commit)
+		}
+	}()
+
+	for _, l := range values {
+		if _, ok := tx.entries[l]; ok {
+			continue
+		}
+		e, err := l.acquire()
+		if err != nil {
+			return err
+		}
+		tx.entries[l] = e
+	}
+
+	if err := f(tx); err != nil {
+		return err
+	}
+	commit = true
+	return nil
+}
+
+func (o *Of[T]) order() uint64 {
+	return o.id
+}
+
+type txRelease[T any] struct {
+	v   T
+	set bool
+}
+
+// acquire blocks the owning goroutine of o, until the returned entry is
+// released.
+func (o *Of[T]) acquire() (txEntry, error) {
+	got := make(chan T, 1)
+	rel := make(chan txRelease[T], 1)
+	err := o.send(context.Background(), func(v T) T {
+		got <- v
+		r := <-rel
+		if !r.set {
+			o.unchanged = true
+			return v
+		}
+		return r.v
+	})
+	if err != nil {
+		return nil, err
+	}
+	// A sent filter is always applied.
+	v := <-got
+	o.debug.setHolder(true)
+	return &entry[T]{v: v, rel: rel, o: o}, nil
+}
@@ -0,0 +1,140 @@
+package owned
+
+import "context"
+
+// waiter is a pending WaitFor.
+type waiter[T any] struct {
+	pred func(T) bool
+	c    chan T
+	err  *PanicError
+}
+
+// Watch returns a channel, on which every new value is sent after a filter
+// modified it. Every filter passed to Do counts as a modification, while Get
+// and a CAS that did not swap do not. Values are coalesced for slow receivers (like with
+// toggle.Last), so a receive always yields the latest value. The channel is
+// closed by Unwatch or when o is closed.
+func (o *Of[T]) Watch() <-chan T {
+	c := make(chan T, 1)
+	err := o.filter(context.Background(), func(v T) T {
+		if o.watchers == nil {
+			o.watchers = make(map[<-chan T]chan T)
+		}
+		o.watchers[c] = c
+		o.unchanged = true
+		return v
+	})
+	if err != nil {
+		close(c)
+	}
+	return c
+}
+
+// Unwatch stops sending values to c, which must have been returned by Watch,
+// and closes it.
+func (o *Of[T]) Unwatch(c <-chan T) {
+	o.filter(context.Background(), func(v T) T {
+		if w, ok := o.watchers[c]; ok {
+			delete(o.watchers, c)
+			close(w)
+		}
+		o.unchanged = true
+		return v
+	})
+}
+
+// WaitFor blocks until pred returns true for the held value and returns that
+// value. pred is called with the current value and then with every new value
+// in the owning goroutine, so no change is missed, but pred must not block.
+// If o is closed, WaitFor returns the zero value. If pred panics, WaitFor
+// panics with a *PanicError.
+func (o *Of[T]) WaitFor(pred func(T) bool) T {
+	v, err := o.WaitForContext(context.Background(), pred)
+	if err != nil && err != ErrClosed {
+		panic(err)
+	}
+	return v
+}
+
+// WaitForContext is like WaitFor, but gives up if ctx is cancelled first. It
+// returns ErrClosed, if o is closed, ctx.Err(), if ctx is cancelled, and a
+// *PanicError, if pred panics.
+func (o *Of[T]) WaitForContext(ctx context.Context, pred func(T) bool) (T, error) {
+	var zero T
+
+	w := &waiter[T]{pred: pred, c: make(chan T, 1)}
+	err := o.filter(ctx, func(v T) T {
+		if !o.check(w, v) {
+			if o.waiters == nil {
+				o.waiters = make(map[*waiter[T]]bool)
+			}
+			o.waiters[w] = true
+		}
+		o.unchanged = true
+		return v
+	})
+	if err != nil {
+		return zero, err
+	}
+
+	select {
+	case v, ok := <-w.c:
+		if !ok {
+			if w.err != nil {
+				return zero, w.err
+			}
+			return zero, ErrClosed
+		}
+		return v, nil
+	case <-ctx.Done():
+		o.filter(context.Background(), func(v T) T {
+			delete(o.waiters, w)
+			o.unchanged = true
+			return v
+		})
+		return zero, ctx.Err()
+	}
+}
+
+// check calls the predicate of w with v and completes w, if it returns true
+// or panics. It returns whether w was completed.
+func (o *Of[T]) check(w *waiter[T], v T) bool {
+	var ok bool
+	_, w.err = o.run(func(v T) T {
+		ok = w.pred(v)
+		return v
+	}, v)
+	switch {
+	case w.err != nil:
+		close(w.c)
+	case ok:
+		w.c <- v
+	}
+	return ok || w.err != nil
+}
+
+// notify sends v to all watchers and checks it against all waiters.
+func (o *Of[T]) notify(v T) {
+	for _, c := range o.watchers {
+		select {
+		case <-c:
+		default:
+		}
+		c <- v
+	}
+	for w := range o.waiters {
+		if o.check(w, v) {
+			delete(o.waiters, w)
+		}
+	}
+}
+
+// stopWatchers closes all watchers and waiters, when o is closed.
+func (o *Of[T]) stopWatchers() {
+	for _, c := range o.watchers {
+		close(c)
+	}
+	for w := range o.waiters {
+		close(w.c)
+	}
+}
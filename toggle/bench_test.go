@@ -0,0 +1,85 @@
+package toggle_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"merovius.de/go-misc/toggle"
+)
+
+func TestToggleNoGoroutines(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ts := make([]*toggle.Toggle[int], 1000)
+	for i := range ts {
+		ts[i] = toggle.NewLast[int]()
+		ts[i].Set(i)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines running for %d toggles", n-before, len(ts))
+	}
+	for i, tg := range ts {
+		if v := <-tg.C(); v != i {
+			t.Errorf("Read %d from toggle %d", v, i)
+		}
+	}
+}
+
+func TestCloseReleasesGoroutine(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		r, w := toggle.LastOf[int]()
+		w <- i
+		close(w)
+		for range r {
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines leaked", n-before)
+	}
+}
+
+func BenchmarkCreate(b *testing.B) {
+	b.Run("Channels", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, w := toggle.LastOf[int]()
+			close(w)
+		}
+	})
+	b.Run("Toggle", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			toggle.NewLast[int]().Close()
+		}
+	})
+}
+
+func BenchmarkSetRead(b *testing.B) {
+	b.Run("Channels", func(b *testing.B) {
+		b.ReportAllocs()
+		r, w := toggle.LastOf[int]()
+		defer close(w)
+		for i := 0; i < b.N; i++ {
+			w <- i
+			w <- i
+			<-r
+		}
+	})
+	b.Run("Toggle", func(b *testing.B) {
+		b.ReportAllocs()
+		t := toggle.NewLast[int]()
+		defer t.Close()
+		for i := 0; i < b.N; i++ {
+			t.Set(i)
+			t.Set(i)
+			<-t.C()
+		}
+	})
+}
@@ -0,0 +1,105 @@
+package toggle
+
+import "sync"
+
+// Broadcast is a toggle with any number of readers. Every reader subscribes
+// to get its own channel, from which a read succeeds iff there was a Set since
+// its last read. Like Toggle, it does not need a goroutine.
+type Broadcast[T, A any] struct {
+	first func(T) A
+	f     func(A, T) A
+
+	mtx    sync.Mutex
+	subs   map[<-chan A]chan A
+	closed bool
+}
+
+// BroadcastFirst returns a new Broadcast, whose readers each read the first
+// value set since their last read.
+func BroadcastFirst[T any]() *Broadcast[T, T] {
+	return newBroadcast(identity[T], func(acc, _ T) T { return acc })
+}
+
+// BroadcastLast returns a new Broadcast, whose readers each read the last
+// value set since their last read.
+func BroadcastLast[T any]() *Broadcast[T, T] {
+	return newBroadcast(identity[T], func(_, v T) T { return v })
+}
+
+// BroadcastReduce returns a new Broadcast, whose readers each read all values
+// set since their last read, combined by f. See Reduce.
+func BroadcastReduce[T, A any](init A, f func(acc A, v T) A) *Broadcast[T, A] {
+	return newBroadcast(func(v T) A { return f(init, v) }, f)
+}
+
+func newBroadcast[T, A any](first func(T) A, f func(A, T) A) *Broadcast[T, A] {
+	return &Broadcast[T, A]{
+		first: first,
+		f:     f,
+		subs:  make(map[<-chan A]chan A),
+	}
+}
+
+// Subscribe returns a new channel to read from b. Only values set after the
+// call to Subscribe can be read from it. If b is closed, the returned channel
+// is closed.
+func (b *Broadcast[T, A]) Subscribe() <-chan A {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	c := make(chan A, 1)
+	if b.closed {
+		close(c)
+		return c
+	}
+	b.subs[c] = c
+	return c
+}
+
+// Unsubscribe stops sending values to c, which must have been returned by
+// Subscribe, and closes it. A pending value can still be read from c.
+func (b *Broadcast[T, A]) Unsubscribe(c <-chan A) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if s, ok := b.subs[c]; ok {
+		delete(b.subs, c)
+		close(s)
+	}
+}
+
+// Set sets the value of b for all subscribers. It never blocks. If b is
+// closed, it returns ErrClosed.
+func (b *Broadcast[T, A]) Set(v T) error {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+	for _, c := range b.subs {
+		select {
+		case acc := <-c:
+			c <- b.f(acc, v)
+		default:
+			c <- b.first(v)
+		}
+	}
+	return nil
+}
+
+// Close closes b and all subscribed channels. They are closed after a
+// pending value was read.
+func (b *Broadcast[T, A]) Close() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for c, s := range b.subs {
+		delete(b.subs, c)
+		close(s)
+	}
+}
@@ -0,0 +1,181 @@
+package toggle
+
+import (
+	"sync"
+	"time"
+
+	"merovius.de/go-misc/ct"
+)
+
+// Edge selects when Debounce and Throttle deliver values.
+type Edge uint8
+
+const (
+	// Leading delivers the first value at the start of a period.
+	Leading Edge = 1 << iota
+	// Trailing delivers the last value at the end of a period.
+	Trailing
+)
+
+// TimingOptions configure Debounce and Throttle.
+type TimingOptions struct {
+	// Edge selects when values are delivered. If zero, Debounce uses
+	// Trailing and Throttle uses Leading|Trailing.
+	Edge Edge
+
+	// Clock, if not nil, is used instead of ct.RealClock.
+	Clock ct.Clock
+}
+
+// Timed is a toggle, which only makes values readable at certain times. A
+// read yields the last value delivered since the last read. Like Toggle, it
+// does not need a goroutine while idle.
+type Timed[T any] struct {
+	d        time.Duration
+	edge     Edge
+	clock    ct.Clock
+	throttle bool
+
+	mtx     sync.Mutex
+	c       chan T
+	timer   ct.ClockTimer
+	gen     uint64
+	active  bool
+	pending bool
+	v       T
+	closed  bool
+}
+
+// Debounce returns a new Timed, that makes a value readable only after a quiet
+// period of d without Set. With the Leading edge, the first value of a burst
+// is readable immediately.
+func Debounce[T any](d time.Duration, opts TimingOptions) *Timed[T] {
+	if opts.Edge == 0 {
+		opts.Edge = Trailing
+	}
+	return newTimed[T](d, opts, false)
+}
+
+// Throttle returns a new Timed, that makes a value readable at most once per
+// d. With the Leading edge, the first value after an idle period is readable
+// immediately, with the Trailing edge, the last value set during a period is
+// readable at its end.
+func Throttle[T any](d time.Duration, opts TimingOptions) *Timed[T] {
+	if opts.Edge == 0 {
+		opts.Edge = Leading | Trailing
+	}
+	return newTimed[T](d, opts, true)
+}
+
+func newTimed[T any](d time.Duration, opts TimingOptions, throttle bool) *Timed[T] {
+	if opts.Clock == nil {
+		opts.Clock = ct.RealClock
+	}
+	return &Timed[T]{
+		d:        d,
+		edge:     opts.Edge,
+		clock:    opts.Clock,
+		throttle: throttle,
+		c:        make(chan T, 1),
+	}
+}
+
+// Set sets the value of t. It never blocks. If t is closed, it returns
+// ErrClosed.
+func (t *Timed[T]) Set(v T) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	if !t.active {
+		t.active = true
+		if t.edge&Leading != 0 {
+			t.deliver(v)
+		} else {
+			t.v, t.pending = v, true
+		}
+		t.start()
+		return nil
+	}
+
+	if t.edge&Trailing != 0 {
+		t.v, t.pending = v, true
+	}
+	if !t.throttle {
+		// Debouncing restarts the quiet period.
+		t.timer.Stop()
+		t.start()
+	}
+	return nil
+}
+
+// start starts a new period. t.mtx must be held.
+func (t *Timed[T]) start() {
+	t.gen++
+	gen := t.gen
+	t.timer = t.clock.AfterFunc(t.d, func() {
+		t.expire(gen)
+	})
+}
+
+// expire ends the period started as gen.
+func (t *Timed[T]) expire(gen uint64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if gen != t.gen || t.closed {
+		return
+	}
+	if !t.pending {
+		t.active = false
+		return
+	}
+	t.deliver(t.v)
+	if t.throttle {
+		// The delivery starts a new period, so the next one is at least
+		// d later.
+		t.start()
+	} else {
+		t.active = false
+	}
+}
+
+// deliver makes v readable, replacing a value that was not read yet. t.mtx
+// must be held.
+func (t *Timed[T]) deliver(v T) {
+	var zero T
+	t.v, t.pending = zero, false
+	select {
+	case <-t.c:
+	default:
+	}
+	t.c <- v
+}
+
+// C returns the channel the value can be read from.
+func (t *Timed[T]) C() <-chan T {
+	return t.c
+}
+
+// Close closes t. A value waiting for the trailing edge is made readable
+// immediately. The channel returned by C is closed after a pending value was
+// read.
+func (t *Timed[T]) Close() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.closed {
+		return
+	}
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	if t.pending {
+		t.deliver(t.v)
+	}
+	t.closed = true
+	close(t.c)
+}
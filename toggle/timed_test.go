@@ -0,0 +1,97 @@
+package toggle_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"merovius.de/go-misc/ct"
+	"merovius.de/go-misc/toggle"
+)
+
+// read returns the value readable from c, if any.
+func read(c <-chan int) string {
+	select {
+	case v, ok := <-c:
+		if !ok {
+			return "closed"
+		}
+		return fmt.Sprint(v)
+	default:
+		return "-"
+	}
+}
+
+func TestTimed(t *testing.T) {
+	// Each step sets a value (if not 0), advances the clock by 10ms and reads.
+	tcs := []struct {
+		name  string
+		new   func(ct.Clock) *toggle.Timed[int]
+		sets  []int
+		reads []string
+	}{
+		{
+			name: "Debounce",
+			new: func(c ct.Clock) *toggle.Timed[int] {
+				return toggle.Debounce[int](25*time.Millisecond, toggle.TimingOptions{Clock: c})
+			},
+			sets:  []int{1, 2, 3, 0, 0, 0, 4},
+			reads: []string{"-", "-", "-", "-", "3", "-", "-"},
+		},
+		{
+			name: "DebounceLeading",
+			new: func(c ct.Clock) *toggle.Timed[int] {
+				return toggle.Debounce[int](25*time.Millisecond, toggle.TimingOptions{Edge: toggle.Leading, Clock: c})
+			},
+			sets:  []int{1, 2, 3, 0, 0, 0, 4},
+			reads: []string{"1", "-", "-", "-", "-", "-", "4"},
+		},
+		{
+			name: "Throttle",
+			new: func(c ct.Clock) *toggle.Timed[int] {
+				return toggle.Throttle[int](25*time.Millisecond, toggle.TimingOptions{Clock: c})
+			},
+			sets:  []int{1, 2, 3, 4, 5, 0, 0, 0, 6},
+			reads: []string{"1", "-", "3", "-", "5", "-", "-", "-", "6"},
+		},
+		{
+			name: "ThrottleTrailing",
+			new: func(c ct.Clock) *toggle.Timed[int] {
+				return toggle.Throttle[int](25*time.Millisecond, toggle.TimingOptions{Edge: toggle.Trailing, Clock: c})
+			},
+			sets:  []int{1, 2, 3, 4, 5, 0, 0, 0},
+			reads: []string{"-", "-", "3", "-", "5", "-", "-", "-"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			c := ct.NewFakeClock(time.Time{})
+			tm := tc.new(c)
+			for i, v := range tc.sets {
+				if v != 0 {
+					tm.Set(v)
+				}
+				c.Advance(10 * time.Millisecond)
+				if got := read(tm.C()); got != tc.reads[i] {
+					t.Errorf("Read %s after step %d, expected %s", got, i, tc.reads[i])
+				}
+			}
+			tm.Close()
+			for range tm.C() {
+			}
+		})
+	}
+}
+
+func TestTimedCloseDeliversTrailing(t *testing.T) {
+	c := ct.NewFakeClock(time.Time{})
+	tm := toggle.Debounce[int](time.Second, toggle.TimingOptions{Clock: c})
+	tm.Set(42)
+	tm.Close()
+	if got := read(tm.C()); got != "42" {
+		t.Errorf("Read %s after Close, expected 42", got)
+	}
+	if got := read(tm.C()); got != "closed" {
+		t.Errorf("Read %s after pending value, expected closed", got)
+	}
+}
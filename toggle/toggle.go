@@ -4,31 +4,40 @@
 // there was a send to w since the last read. A send to w will never block.
 // When w is closed, r is closed and all associated resources are released,
 // but only after a potential value written to w was read.
+//
+// FirstOf, LastOf and Toggle are the type-safe variants. First and Last are
+// kept as wrappers for interface{} values. Reduce combines all values written
+// since the last read.
 package toggle
 
-func create(last bool) (chan interface{}, chan interface{}) {
-	r, w := make(chan interface{}), make(chan interface{})
+import (
+	"errors"
+	"sync"
+)
+
+// fold creates a toggle. The first value written after a read is converted
+// with first, further ones are combined with it by f.
+func fold[T, A any](first func(T) A, f func(A, T) A) (chan A, chan T) {
+	r, w := make(chan A), make(chan T)
 
 	go func() {
-		var v interface{}
-		var ok bool
 		for {
-			v, ok = <-w
+			v, ok := <-w
 			if !ok {
-				w = nil
+				close(r)
+				return
 			}
+			acc := first(v)
 		L:
 			for {
 				select {
-				case V, ok := <-w:
-					if last {
-						v = V
-					}
+				case v, ok := <-w:
 					if !ok {
 						w = nil
+					} else {
+						acc = f(acc, v)
 					}
-				case r <- v:
-					v = nil
+				case r <- acc:
 					break L
 				}
 			}
@@ -43,14 +52,166 @@ func create(last bool) (chan interface{}, chan interface{}) {
 	return r, w
 }
 
+func identity[T any](v T) T {
+	return v
+}
+
+// FirstOf returns a new toggle, that yields the first value written to w since
+// the last read.
+func FirstOf[T any]() (r <-chan T, w chan<- T) {
+	return fold(identity[T], func(acc, _ T) T { return acc })
+}
+
+// LastOf returns a new toggle, that yields the last value written to w since
+// the last read.
+func LastOf[T any]() (r <-chan T, w chan<- T) {
+	return fold(identity[T], func(_, v T) T { return v })
+}
+
+// Reduce returns a new toggle, that yields all values written to w since the
+// last read, combined by f. The accumulator starts out as init and is reset
+// to init after every read. If A is a reference type (like a map), f should
+// thus not modify init, but e.g. allocate a new map if acc is nil.
+func Reduce[T, A any](init A, f func(acc A, v T) A) (r <-chan A, w chan<- T) {
+	return fold(func(v T) A { return f(init, v) }, f)
+}
+
 // First returns a new toggle, that yields the first value written to w since
 // the last read.
 func First() (r <-chan interface{}, w chan<- interface{}) {
-	return create(false)
+	return FirstOf[interface{}]()
 }
 
 // Last returns a new toggle, that yields the last value written to w since the
 // last read.
 func Last() (r <-chan interface{}, w chan<- interface{}) {
-	return create(true)
+	return LastOf[interface{}]()
+}
+
+var (
+	// ErrClosed is returned when setting a closed toggle, and by Err after
+	// Close.
+	ErrClosed = errors.New("toggle: closed")
+
+	// ErrAborted is returned by Err after Abort with a nil error.
+	ErrAborted = errors.New("toggle: aborted")
+)
+
+// Toggle is a toggle with the same semantics as the channels returned by
+// FirstOf and LastOf, but it does not need a goroutine. Its value is kept in a
+// channel with a buffer of one, which is replaced by Set. Thus, a Toggle that
+// is never closed does not leak any resources.
+type Toggle[T any] struct {
+	mtx  sync.Mutex
+	c    chan T
+	last bool
+	// v is the value last sent to c, for Peek.
+	v   T
+	err error
+}
+
+// NewFirst returns a new Toggle, that yields the first value set since the
+// last read.
+func NewFirst[T any]() *Toggle[T] {
+	return &Toggle[T]{c: make(chan T, 1)}
+}
+
+// NewLast returns a new Toggle, that yields the last value set since the last
+// read.
+func NewLast[T any]() *Toggle[T] {
+	return &Toggle[T]{c: make(chan T, 1), last: true}
+}
+
+// Set sets the value of t. It never blocks. If t is closed, it returns the
+// error returned by Err.
+func (t *Toggle[T]) Set(v T) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.err != nil {
+		return t.err
+	}
+	if t.last {
+		select {
+		case <-t.c:
+		default:
+		}
+	}
+	select {
+	case t.c <- v:
+		t.v = v
+	default:
+	}
+	return nil
+}
+
+// C returns the channel the value can be read from.
+func (t *Toggle[T]) C() <-chan T {
+	return t.c
+}
+
+// TryRead reads the pending value, if any, without blocking.
+func (t *Toggle[T]) TryRead() (v T, ok bool) {
+	select {
+	case v, ok = <-t.c:
+		return v, ok
+	default:
+		return v, false
+	}
+}
+
+// Peek returns the pending value, if any, without consuming it.
+func (t *Toggle[T]) Peek() (v T, ok bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if len(t.c) == 0 {
+		return v, false
+	}
+	return t.v, true
+}
+
+// Close closes t. The channel returned by C is closed after a pending value
+// was read. Afterwards, Err returns ErrClosed.
+func (t *Toggle[T]) Close() {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if t.err != nil {
+		return
+	}
+	t.err = ErrClosed
+	close(t.c)
+}
+
+// Abort closes t and drops a pending value, so the channel returned by C is
+// closed immediately. Afterwards, Err returns err, or ErrAborted if err is
+// nil. Abort can also drop the pending value of a closed toggle.
+func (t *Toggle[T]) Abort(err error) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if err == nil {
+		err = ErrAborted
+	}
+	switch t.err {
+	case nil:
+		close(t.c)
+	case ErrClosed:
+	default:
+		return
+	}
+	t.err = err
+	for range t.c {
+	}
+	var zero T
+	t.v = zero
+}
+
+// Err returns nil, if t is open, ErrClosed, if it was closed by Close, and
+// the reason passed to Abort otherwise.
+func (t *Toggle[T]) Err() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.err
 }
@@ -1,6 +1,7 @@
 package toggle_test
 
 import (
+	"errors"
 	"fmt"
 
 	"merovius.de/go-misc/toggle"
@@ -36,3 +37,94 @@ func Example() {
 	// Second
 	// Fourth
 }
+
+func ExampleToggle() {
+	t := toggle.NewLast[int]()
+
+	t.Set(1)
+	t.Set(2)
+	fmt.Println(<-t.C())
+
+	t.Set(3)
+	t.Close()
+	for v := range t.C() {
+		fmt.Println(v)
+	}
+
+	// Output:
+	// 2
+	// 3
+}
+
+func ExampleReduce() {
+	// Collect the set of dirty keys since the last read.
+	r, w := toggle.Reduce(nil, func(dirty map[string]bool, k string) map[string]bool {
+		if dirty == nil {
+			dirty = make(map[string]bool)
+		}
+		dirty[k] = true
+		return dirty
+	})
+
+	w <- "foo"
+	w <- "bar"
+	w <- "foo"
+	fmt.Println(<-r)
+
+	w <- "baz"
+	close(w)
+	fmt.Println(<-r)
+	_, ok := <-r
+	fmt.Println(ok)
+
+	// Output:
+	// map[bar:true foo:true]
+	// map[baz:true]
+	// false
+}
+
+func ExampleBroadcast() {
+	b := toggle.BroadcastLast[int]()
+	r1, r2 := b.Subscribe(), b.Subscribe()
+
+	b.Set(1)
+	fmt.Println("r1:", <-r1)
+	b.Set(2)
+	b.Set(3)
+	fmt.Println("r1:", <-r1)
+	fmt.Println("r2:", <-r2)
+
+	b.Unsubscribe(r1)
+	b.Set(4)
+	b.Close()
+	for v := range r2 {
+		fmt.Println("r2:", v)
+	}
+
+	// Output:
+	// r1: 1
+	// r1: 3
+	// r2: 3
+	// r2: 4
+}
+
+func ExampleToggle_Abort() {
+	t := toggle.NewFirst[string]()
+
+	t.Set("pending")
+	fmt.Println(t.Peek())
+	fmt.Println(t.Peek())
+
+	t.Abort(errors.New("shutting down"))
+	_, ok := <-t.C()
+	fmt.Println(ok)
+	fmt.Println(t.Err())
+	fmt.Println(t.Set("too late"))
+
+	// Output:
+	// pending true
+	// pending true
+	// false
+	// shutting down
+	// shutting down
+}
@@ -0,0 +1,129 @@
+package toggle
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned by Loop, if the callback panics.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the panic.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("toggle: callback panicked: %v", e.Value)
+}
+
+// A Source is a toggle, which reports why its channel was closed, like a
+// *Toggle.
+type Source[T any] interface {
+	// C returns the read channel.
+	C() <-chan T
+	// Err returns ErrClosed, if the channel was closed normally, and the
+	// reason for aborting otherwise.
+	Err() error
+}
+
+// Wait reads a value from r, which can be the read channel of any toggle. It
+// returns ErrClosed, if r is closed, and ctx.Err(), if ctx is cancelled
+// first. Use WaitSource to tell an aborted toggle from a closed one.
+func Wait[T any](ctx context.Context, r <-chan T) (T, error) {
+	return wait(ctx, r, nil)
+}
+
+// WaitSource is like Wait, but reads from s and returns s.Err() if s was
+// aborted.
+func WaitSource[T any](ctx context.Context, s Source[T]) (T, error) {
+	return wait(ctx, s.C(), s.Err)
+}
+
+// wait implements Wait. If errf is not nil, it is called to determine the
+// error for a closed r.
+func wait[T any](ctx context.Context, r <-chan T, errf func() error) (T, error) {
+	var zero T
+	select {
+	case v, ok := <-r:
+		if ok {
+			return v, nil
+		}
+		if errf != nil {
+			if err := errf(); err != nil {
+				return zero, err
+			}
+		}
+		return zero, ErrClosed
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// WaitUntil reads values from r, until pred returns true for one and returns
+// that. Errors are the same as for Wait.
+func WaitUntil[T any](ctx context.Context, r <-chan T, pred func(T) bool) (T, error) {
+	return waitUntil(ctx, r, nil, pred)
+}
+
+// WaitUntilSource is like WaitUntil, but reads from s and returns s.Err() if
+// s was aborted.
+func WaitUntilSource[T any](ctx context.Context, s Source[T], pred func(T) bool) (T, error) {
+	return waitUntil(ctx, s.C(), s.Err, pred)
+}
+
+func waitUntil[T any](ctx context.Context, r <-chan T, errf func() error, pred func(T) bool) (T, error) {
+	for {
+		v, err := wait(ctx, r, errf)
+		if err != nil || pred(v) {
+			return v, err
+		}
+	}
+}
+
+// Loop calls f with every value read from r. As r is a toggle, values that
+// are written while f runs are coalesced. Loop returns
+//   - nil, when r is closed,
+//   - ctx.Err(), when ctx is cancelled (f is never called after that),
+//   - the error returned by f, if it is not nil, or
+//   - a *PanicError, if f panics.
+//
+// Use LoopSource to tell an aborted toggle from a closed one.
+func Loop[T any](ctx context.Context, r <-chan T, f func(T) error) error {
+	return loop(ctx, r, nil, f)
+}
+
+// LoopSource is like Loop, but reads from s and returns s.Err() if s was
+// aborted.
+func LoopSource[T any](ctx context.Context, s Source[T], f func(T) error) error {
+	return loop(ctx, s.C(), s.Err, f)
+}
+
+func loop[T any](ctx context.Context, r <-chan T, errf func() error, f func(T) error) error {
+	for {
+		v, err := wait(ctx, r, errf)
+		if err == ErrClosed {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := call(f, v); err != nil {
+			return err
+		}
+	}
+}
+
+// call calls f(v) and returns a panic as a *PanicError.
+func call[T any](f func(T) error, v T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return f(v)
+}
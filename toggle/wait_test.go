@@ -0,0 +1,160 @@
+package toggle_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"merovius.de/go-misc/toggle"
+)
+
+func ExampleLoop() {
+	t := toggle.NewLast[int]()
+	go func() {
+		for i := 1; i <= 3; i++ {
+			t.Set(i)
+		}
+		t.Close()
+	}()
+
+	last := 0
+	err := toggle.Loop(context.Background(), t.C(), func(v int) error {
+		// Depending on timing, some values might be coalesced.
+		last = v
+		return nil
+	})
+	fmt.Println(last, err)
+
+	// Output:
+	// 3 <nil>
+}
+
+func TestWait(t *testing.T) {
+	tg := toggle.NewLast[int]()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := toggle.Wait(ctx, tg.C()); err != context.DeadlineExceeded {
+		t.Errorf("Wait on empty toggle returned %v, expected %v", err, context.DeadlineExceeded)
+	}
+
+	tg.Set(42)
+	if v, err := toggle.Wait(context.Background(), tg.C()); v != 42 || err != nil {
+		t.Errorf("Wait returned (%v, %v), expected (42, <nil>)", v, err)
+	}
+
+	tg.Close()
+	if _, err := toggle.Wait(context.Background(), tg.C()); err != toggle.ErrClosed {
+		t.Errorf("Wait on closed toggle returned %v, expected %v", err, toggle.ErrClosed)
+	}
+}
+
+func TestWaitSource(t *testing.T) {
+	errFoo := errors.New("foo")
+
+	tg := toggle.NewLast[int]()
+	tg.Set(42)
+	if v, err := toggle.WaitSource[int](context.Background(), tg); v != 42 || err != nil {
+		t.Errorf("WaitSource returned (%v, %v), expected (42, <nil>)", v, err)
+	}
+	tg.Close()
+	if _, err := toggle.WaitSource[int](context.Background(), tg); err != toggle.ErrClosed {
+		t.Errorf("WaitSource on closed toggle returned %v, expected %v", err, toggle.ErrClosed)
+	}
+
+	tg = toggle.NewLast[int]()
+	tg.Set(42)
+	tg.Abort(errFoo)
+	if _, err := toggle.Wait(context.Background(), tg.C()); err != toggle.ErrClosed {
+		t.Errorf("Wait on aborted toggle returned %v, expected %v", err, toggle.ErrClosed)
+	}
+	if _, err := toggle.WaitSource[int](context.Background(), tg); err != errFoo {
+		t.Errorf("WaitSource on aborted toggle returned %v, expected %v", err, errFoo)
+	}
+	if _, err := toggle.WaitUntilSource[int](context.Background(), tg, func(int) bool { return true }); err != errFoo {
+		t.Errorf("WaitUntilSource on aborted toggle returned %v, expected %v", err, errFoo)
+	}
+}
+
+func TestLoopSource(t *testing.T) {
+	tg := toggle.NewLast[int]()
+	tg.Set(1)
+	tg.Close()
+	var got []int
+	err := toggle.LoopSource[int](context.Background(), tg, func(v int) error {
+		got = append(got, v)
+		return nil
+	})
+	if err != nil || len(got) != 1 || got[0] != 1 {
+		t.Errorf("LoopSource on closed toggle read %v and returned %v, expected [1] and <nil>", got, err)
+	}
+
+	tg = toggle.NewLast[int]()
+	go func() {
+		tg.Set(1)
+		tg.Abort(nil)
+	}()
+	err = toggle.LoopSource[int](context.Background(), tg, func(int) error { return nil })
+	if err != toggle.ErrAborted {
+		t.Errorf("LoopSource on aborted toggle returned %v, expected %v", err, toggle.ErrAborted)
+	}
+}
+
+func TestWaitUntil(t *testing.T) {
+	r, w := toggle.LastOf[int]()
+	go func() {
+		for i := 0; i < 10; i++ {
+			w <- i
+		}
+	}()
+
+	v, err := toggle.WaitUntil(context.Background(), r, func(v int) bool {
+		return v >= 5
+	})
+	if v < 5 || err != nil {
+		t.Errorf("WaitUntil returned (%v, %v), expected a value >= 5", v, err)
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	errFoo := errors.New("foo")
+
+	tcs := []struct {
+		name string
+		f    func(int) error
+		want func(error) bool
+	}{
+		{"Error", func(int) error { return errFoo }, func(err error) bool {
+			return err == errFoo
+		}},
+		{"Panic", func(int) error { panic("foo") }, func(err error) bool {
+			pe, ok := err.(*toggle.PanicError)
+			return ok && pe.Value == "foo"
+		}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tg := toggle.NewLast[int]()
+			tg.Set(1)
+			if err := toggle.Loop(context.Background(), tg.C(), tc.f); !tc.want(err) {
+				t.Errorf("Loop returned unexpected error %v", err)
+			}
+		})
+	}
+
+	t.Run("Cancel", func(t *testing.T) {
+		tg := toggle.NewLast[int]()
+		tg.Set(1)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		err := toggle.Loop(ctx, tg.C(), func(int) error {
+			t.Error("Callback called after cancellation")
+			return nil
+		})
+		if err != context.Canceled {
+			t.Errorf("Loop returned %v, expected %v", err, context.Canceled)
+		}
+	})
+}